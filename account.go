@@ -0,0 +1,117 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kallydev/telegraph-go"
+	"github.com/pkg/errors"
+)
+
+// EnvAccessToken is the environment variable read by the store returned from NewEnvStore
+// when no other key is given.
+const EnvAccessToken = "TELEGRAPH_ACCESS_TOKEN"
+
+// ErrNoAccount is returned by an AccountStore when no account has been stored yet.
+var ErrNoAccount = errors.New("telegraph account not found")
+
+// AccountStore persists the Telegraph account used for publishing, so that
+// every page lands on the same account and stays editable.
+type AccountStore interface {
+	// Load returns the stored account, or ErrNoAccount if there is none.
+	Load() (*telegraph.Account, error)
+
+	// Save stores the account for later use.
+	Save(*telegraph.Account) error
+}
+
+type fileStore struct {
+	path string
+}
+
+// NewFileStore returns an AccountStore backed by the file at path. The file holds
+// the account encoded as JSON; a file containing only an access token is accepted too.
+func NewFileStore(path string) AccountStore {
+	return &fileStore{path: path}
+}
+
+func (fs *fileStore) Load() (*telegraph.Account, error) {
+	buf, err := os.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoAccount
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read account file failed")
+	}
+
+	buf = bytes.TrimSpace(buf)
+	if len(buf) == 0 {
+		return nil, ErrNoAccount
+	}
+
+	account := &telegraph.Account{}
+	if buf[0] != '{' {
+		account.AccessToken = string(buf)
+		return account, nil
+	}
+	if err := json.Unmarshal(buf, account); err != nil {
+		return nil, errors.Wrap(err, "decode account file failed")
+	}
+	if account.AccessToken == "" {
+		return nil, ErrNoAccount
+	}
+
+	return account, nil
+}
+
+func (fs *fileStore) Save(account *telegraph.Account) error {
+	buf, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode account failed")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0700); err != nil {
+		return errors.Wrap(err, "create account directory failed")
+	}
+
+	// Write to a temporary file first to keep the token intact if writing fails.
+	tmp := fs.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return errors.Wrap(err, "write account file failed")
+	}
+
+	return os.Rename(tmp, fs.path)
+}
+
+type envStore struct {
+	key string
+}
+
+// NewEnvStore returns a read-only AccountStore that takes the access token from the
+// environment variable key, or from EnvAccessToken if key is empty. Saving is a no-op.
+func NewEnvStore(key string) AccountStore {
+	if key == "" {
+		key = EnvAccessToken
+	}
+	return &envStore{key: key}
+}
+
+func (es *envStore) Load() (*telegraph.Account, error) {
+	token := strings.TrimSpace(os.Getenv(es.key))
+	if token == "" {
+		return nil, ErrNoAccount
+	}
+
+	return &telegraph.Account{AccessToken: token}, nil
+}
+
+func (es *envStore) Save(*telegraph.Account) error {
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "account", "telegraph.json")
+	store := NewFileStore(path)
+
+	if _, err := store.Load(); err != ErrNoAccount {
+		t.Fatalf("Unexpected load empty store, got error %v instead of %v", err, ErrNoAccount)
+	}
+
+	want := &telegraph.Account{ShortName: "wabarc", AccessToken: "token"}
+	if err := store.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *want {
+		t.Errorf("Unexpected account, got %#v instead of %#v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("bare-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != "bare-token" {
+		t.Errorf("Unexpected access token, got %s instead of bare-token", got.AccessToken)
+	}
+}
+
+func TestEnvStore(t *testing.T) {
+	store := NewEnvStore("")
+	t.Setenv(EnvAccessToken, "")
+	if _, err := store.Load(); err != ErrNoAccount {
+		t.Fatalf("Unexpected load empty env, got error %v instead of %v", err, ErrNoAccount)
+	}
+
+	t.Setenv(EnvAccessToken, "token")
+	account, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.AccessToken != "token" {
+		t.Errorf("Unexpected access token, got %s instead of token", account.AccessToken)
+	}
+}
+
+func TestReuseAccount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "telegraph.json")
+	if err := os.WriteFile(path, []byte("stored-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	arc := New(WithAccountStore(NewFileStore(path)))
+	client, err := arc.dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.AccessToken != "stored-token" {
+		t.Errorf("Unexpected access token, got %s instead of stored-token", client.AccessToken)
+	}
+	if again, _ := arc.dial(context.Background()); again != client {
+		t.Error("Unexpected client, want the client to be reused")
+	}
+
+	arc = New(WithAccessToken("given-token"), WithAccountStore(NewFileStore(path)))
+	account, err := arc.Account(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.AccessToken != "given-token" {
+		t.Errorf("Unexpected access token, got %s instead of given-token", account.AccessToken)
+	}
+}
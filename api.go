@@ -0,0 +1,233 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kallydev/telegraph-go"
+	"github.com/pkg/errors"
+)
+
+const telegraphAPI = "https://api.telegra.ph"
+
+// api is a Telegraph API client, every call honours the context given.
+type api struct {
+	client   *http.Client
+	endpoint string
+	policy   RetryPolicy
+	log      Logger
+
+	AccessToken string
+}
+
+// WithBaseURL sets the base URL of the Telegraph API, defaults to https://api.telegra.ph.
+func WithBaseURL(base string) Option {
+	return func(arc *Archiver) {
+		arc.baseURL = base
+	}
+}
+
+// WithUploadURL sets the URL images are uploaded to by the default Telegraph uploader,
+// defaults to https://telegra.ph/upload.
+func WithUploadURL(u string) Option {
+	return func(arc *Archiver) {
+		arc.uploadURL = u
+	}
+}
+
+// WithTelegraphClient sets the HTTP client of Telegraph API calls and uploads, e.g. one
+// going through a proxy. Defaults to the client of the archiver.
+func WithTelegraphClient(client *http.Client) Option {
+	return func(arc *Archiver) {
+		arc.tgClient = client
+	}
+}
+
+func (arc *Archiver) telegraphClient() *http.Client {
+	if arc.tgClient != nil {
+		return arc.tgClient
+	}
+	return arc.Client
+}
+
+func newAPI(client *http.Client, token string, policy RetryPolicy, log Logger) *api {
+	return &api{client: httpClient(client), endpoint: telegraphAPI, policy: policy, log: log, AccessToken: token}
+}
+
+// call invokes the API method and decodes its result into v, transient failures are retried.
+func (a *api) call(ctx context.Context, method string, params url.Values, v interface{}) error {
+	return doRetry(ctx, a.policy, a.log, func() error {
+		return a.do(ctx, method, params, v)
+	})
+}
+
+func (a *api) do(ctx context.Context, method string, params url.Values, v interface{}) error {
+	endpoint := strings.TrimRight(a.endpoint, "/") + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		OK     bool            `json:"ok"`
+		Error  string          `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return errors.Wrapf(newStatusError(resp), "telegraph %s", method)
+		}
+		return errors.Wrapf(err, "decode %s response failed", method)
+	}
+	if !res.OK {
+		return &apiError{method: method, message: res.Error}
+	}
+
+	return json.Unmarshal(res.Result, v)
+}
+
+func (a *api) createAccount(ctx context.Context, shortName string, opts *telegraph.CreateAccountOption) (*telegraph.Account, error) {
+	params := url.Values{}
+	params.Set("short_name", shortName)
+	if opts != nil {
+		setParam(params, "author_name", opts.AuthorName)
+		setParam(params, "author_url", opts.AuthorURL)
+	}
+
+	account := &telegraph.Account{}
+	if err := a.call(ctx, "createAccount", params, account); err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (a *api) createPage(ctx context.Context, title string, content []telegraph.Node, opts *telegraph.CreatePageOption) (*telegraph.Page, error) {
+	params, err := a.pageParams(title, content)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil {
+		setParam(params, "author_name", opts.AuthorName)
+		setParam(params, "author_url", opts.AuthorURL)
+		if opts.ReturnContent {
+			params.Set("return_content", "true")
+		}
+	}
+
+	page := &telegraph.Page{}
+	if err := a.call(ctx, "createPage", params, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (a *api) editPage(ctx context.Context, path, title string, content []telegraph.Node, opts *telegraph.EditPageOption) (*telegraph.Page, error) {
+	params, err := a.pageParams(title, content)
+	if err != nil {
+		return nil, err
+	}
+	params.Set("path", path)
+	if opts != nil {
+		setParam(params, "author_name", opts.AuthorName)
+		setParam(params, "author_url", opts.AuthorURL)
+		if opts.ReturnContent {
+			params.Set("return_content", "true")
+		}
+	}
+
+	page := &telegraph.Page{}
+	if err := a.call(ctx, "editPage", params, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (a *api) getPage(ctx context.Context, path string, returnContent bool) (*telegraph.Page, error) {
+	params := url.Values{}
+	params.Set("path", path)
+	if returnContent {
+		params.Set("return_content", "true")
+	}
+
+	page := &telegraph.Page{}
+	if err := a.call(ctx, "getPage", params, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (a *api) getPageList(ctx context.Context, offset, limit int) (*telegraph.PageList, error) {
+	params := url.Values{}
+	params.Set("access_token", a.AccessToken)
+	params.Set("offset", strconv.Itoa(offset))
+	params.Set("limit", strconv.Itoa(limit))
+
+	list := &telegraph.PageList{}
+	if err := a.call(ctx, "getPageList", params, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// getViews returns the views of the page, period holds the optional year, month, day
+// and hour parameters.
+func (a *api) getViews(ctx context.Context, path string, period map[string]string) (int, error) {
+	params := url.Values{}
+	params.Set("path", path)
+	for k, v := range period {
+		params.Set(k, v)
+	}
+
+	views := &telegraph.PageViews{}
+	if err := a.call(ctx, "getViews", params, views); err != nil {
+		return 0, err
+	}
+
+	return views.Views, nil
+}
+
+func (a *api) pageParams(title string, content []telegraph.Node) (url.Values, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode content failed")
+	}
+
+	params := url.Values{}
+	params.Set("access_token", a.AccessToken)
+	params.Set("title", title)
+	params.Set("content", string(data))
+
+	return params, nil
+}
+
+func setParam(params url.Values, key, val string) {
+	if val != "" {
+		params.Set(key, val)
+	}
+}
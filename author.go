@@ -0,0 +1,61 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+const (
+	defaultShortName  = "telegraph-go"
+	defaultAuthorName = "Anonymous"
+	defaultAuthorURL  = "https://example.org"
+)
+
+// Author describes the identity of the Telegraph account and the byline of published pages.
+type Author struct {
+	// ShortName is the account name, only shown to the account owner.
+	ShortName string
+
+	// Name and URL are the author name and link of the account.
+	Name string
+	URL  string
+
+	// Brand credits published pages to Name and URL instead of the source
+	// webpage, the source is then linked in the page body.
+	Brand bool
+}
+
+// WithAuthor sets the author of the Telegraph account and published pages.
+func WithAuthor(author Author) Option {
+	return func(arc *Archiver) {
+		arc.Author = author
+	}
+}
+
+func (a Author) shortName() string {
+	if a.ShortName != "" {
+		return a.ShortName
+	}
+	return defaultShortName
+}
+
+func (a Author) name() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return defaultAuthorName
+}
+
+func (a Author) url() string {
+	if a.URL != "" {
+		return a.URL
+	}
+	return defaultAuthorURL
+}
+
+// byline returns the author name and link of a page archived from source.
+func (a Author) byline(source string) (name, link string) {
+	if a.Brand {
+		return a.name(), a.URL
+	}
+	return "Source", source
+}
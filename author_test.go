@@ -0,0 +1,28 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import "testing"
+
+func TestAuthorByline(t *testing.T) {
+	source := "https://example.com/"
+	tests := []struct {
+		author Author
+		name   string
+		link   string
+	}{
+		{Author{}, "Source", source},
+		{Author{Name: "wabarc", URL: "https://github.com/wabarc"}, "Source", source},
+		{Author{Name: "wabarc", URL: "https://github.com/wabarc", Brand: true}, "wabarc", "https://github.com/wabarc"},
+		{Author{Brand: true}, defaultAuthorName, ""},
+	}
+
+	for _, test := range tests {
+		name, link := test.author.byline(source)
+		if name != test.name || link != test.link {
+			t.Errorf("Unexpected byline of %#v, got %s %s instead of %s %s", test.author, name, link, test.name, test.link)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ImageCache maps transferred images to their uploaded URLs, images are keyed
+// both by source URL and by the SHA-256 of their content.
+type ImageCache interface {
+	// Get returns the uploaded URL of key, and whether it was found.
+	Get(key string) (string, bool)
+
+	// Set records the uploaded URL of key.
+	Set(key, url string) error
+}
+
+// WithImageCache sets the cache of transferred images, defaults to an in-memory
+// cache living as long as the archiver.
+func WithImageCache(cache ImageCache) Option {
+	return func(arc *Archiver) {
+		arc.cache = cache
+	}
+}
+
+// imageCache returns the image cache of the archiver, created on first use.
+func (arc *Archiver) imageCache() ImageCache {
+	arc.cacheOnce.Do(func() {
+		if arc.cache == nil {
+			arc.cache = NewMemoryCache()
+		}
+	})
+	return arc.cache
+}
+
+func sourceKey(src string) string {
+	return "url:" + src
+}
+
+func contentKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type memoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]string
+}
+
+// NewMemoryCache returns an ImageCache kept in memory.
+func NewMemoryCache() ImageCache {
+	return &memoryCache{entries: make(map[string]string)}
+}
+
+func (mc *memoryCache) Get(key string) (string, bool) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	url, ok := mc.entries[key]
+	return url, ok
+}
+
+func (mc *memoryCache) Set(key, url string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.entries[key] = url
+	return nil
+}
+
+type fileCache struct {
+	memoryCache
+
+	wmu  sync.Mutex
+	file *os.File
+}
+
+type cacheEntry struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// NewFileCache returns an ImageCache persisted to the file at path. Entries are
+// appended to the file as JSON lines and loaded into memory on open, the returned
+// cache implements io.Closer to release the file.
+func NewFileCache(path string) (ImageCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.Wrap(err, "create cache directory failed")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "open cache file failed")
+	}
+
+	fc := &fileCache{memoryCache: memoryCache{entries: make(map[string]string)}, file: file}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry cacheEntry
+		// Skip a line broken by an interrupted write.
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.Key == "" {
+			continue
+		}
+		fc.entries[entry.Key] = entry.URL
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "read cache file failed")
+	}
+
+	return fc, nil
+}
+
+func (fc *fileCache) Set(key, url string) error {
+	if cached, ok := fc.Get(key); ok && cached == url {
+		return nil
+	}
+	fc.memoryCache.Set(key, url) // nolint:errcheck
+
+	buf, err := json.Marshal(cacheEntry{Key: key, URL: url})
+	if err != nil {
+		return err
+	}
+
+	fc.wmu.Lock()
+	defer fc.wmu.Unlock()
+	_, err = fc.file.Write(append(buf, '\n'))
+
+	return err
+}
+
+// Close closes the cache file.
+func (fc *fileCache) Close() error {
+	return fc.file.Close()
+}
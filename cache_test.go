@@ -0,0 +1,77 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+func TestFileCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "images.jsonl")
+	cache, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set("url:https://example.org/logo.png", "https://telegra.ph/file/logo.png"); err != nil {
+		t.Fatal(err)
+	}
+	cache.(io.Closer).Close()
+
+	cache, err = NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.(io.Closer).Close()
+
+	url, ok := cache.Get("url:https://example.org/logo.png")
+	if !ok || url != "https://telegra.ph/file/logo.png" {
+		t.Errorf("Unexpected cached url, got %s", url)
+	}
+	if _, ok := cache.Get("url:https://example.org/missing.png"); ok {
+		t.Error("Unexpected cached url of missing key")
+	}
+}
+
+// nolint:errcheck
+func TestTransferImagesDeduplicate(t *testing.T) {
+	var downloads, uploads int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		io.WriteString(w, "same image")
+	}))
+	defer ts.Close()
+
+	uploader := uploaderFunc(func(_ context.Context, r io.Reader, _ string) (string, error) {
+		atomic.AddInt32(&uploads, 1)
+		return "https://example.org/uploaded.png", nil
+	})
+	arc := New(WithImageUploaders(uploader))
+
+	page := func(srcs ...string) []telegraph.Node {
+		var nodes []telegraph.Node
+		for _, src := range srcs {
+			nodes = append(nodes, telegraph.NodeElement{Tag: "img", Attrs: map[string]string{"src": src}})
+		}
+		return nodes
+	}
+	logo, avatar := ts.URL+"/logo.png", ts.URL+"/avatar.png"
+	arc.transferImages(context.Background(), page(logo, logo, logo, avatar))
+	arc.transferImages(context.Background(), page(logo, avatar))
+
+	if downloads != 2 {
+		t.Errorf("Unexpected downloads, got %d instead of 2", downloads)
+	}
+	if uploads != 1 {
+		t.Errorf("Unexpected uploads, got %d instead of 1", uploads)
+	}
+}
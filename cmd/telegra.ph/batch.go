@@ -0,0 +1,141 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wabarc/telegra.ph"
+)
+
+// readInput appends the URLs listed in the file to args, one per line, or in stdin
+// if the path is "-". Blank lines and lines starting with # are skipped.
+func readInput(path string, args []string) ([]string, error) {
+	if path == "" {
+		return args, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args = append(args, line)
+	}
+	return args, scanner.Err()
+}
+
+// loadDone returns the URLs recorded as done in the results file, missing file
+// means none. Lines that fail to decode, e.g. cut by an interrupted run, are skipped.
+func loadDone(path string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var r ph.Report
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			continue
+		}
+		if r.Done() {
+			done[r.Source] = true
+		}
+	}
+	return done, scanner.Err()
+}
+
+// process archives the URLs with a pool of parallel workers, URLs recorded as
+// done in the results file are skipped. It reports whether all succeeded.
+func process(f func(context.Context, *url.URL) (*ph.Result, error), args []string) (bool, error) {
+	p := &printer{w: os.Stdout, json: *output == "json", ordered: *ordered}
+	if *results != "" {
+		done, err := loadDone(*results)
+		if err != nil {
+			return false, err
+		}
+		links := args[:0]
+		for _, link := range args {
+			if !done[link] {
+				links = append(links, link)
+			}
+		}
+		args = links
+
+		rf, err := os.OpenFile(*results, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return false, err
+		}
+		defer rf.Close()
+		p.record = rf
+	}
+
+	type job struct {
+		i    int
+		link string
+	}
+	workers := *parallel
+	if workers < 1 {
+		workers = 1
+	}
+
+	var failed int32
+	var wg sync.WaitGroup
+	jobs := make(chan job)
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				u, err := url.Parse(j.link)
+				if err != nil {
+					atomic.StoreInt32(&failed, 1)
+					p.print(j.i, j.link, nil, err)
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+				r, err := f(ctx, u)
+				cancel()
+				if err != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+				p.print(j.i, j.link, r, err)
+			}
+		}()
+	}
+	for i, link := range args {
+		jobs <- job{i: i, link: link}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return atomic.LoadInt32(&failed) == 0, nil
+}
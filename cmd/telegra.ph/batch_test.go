@@ -0,0 +1,111 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		args  []string
+		links []string
+	}{
+		{
+			name:  "links",
+			input: "https://example.org/a\nhttps://example.org/b\n",
+			links: []string{"https://example.org/a", "https://example.org/b"},
+		},
+		{
+			name:  "blank and comment lines",
+			input: "# sources\n\nhttps://example.org/a\n   \n  # skipped\n  https://example.org/b  \r\n",
+			links: []string{"https://example.org/a", "https://example.org/b"},
+		},
+		{
+			name:  "after args",
+			input: "https://example.org/b",
+			args:  []string{"https://example.org/a"},
+			links: []string{"https://example.org/a", "https://example.org/b"},
+		},
+		{
+			name:  "empty",
+			input: "\n# nothing\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "urls.txt")
+			if err := os.WriteFile(path, []byte(test.input), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			links, err := readInput(path, test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(links, test.links) {
+				t.Errorf("Unexpected links, got %q instead of %q", links, test.links)
+			}
+		})
+	}
+}
+
+func TestLoadDone(t *testing.T) {
+	tests := []struct {
+		name    string
+		results string
+		done    map[string]bool
+	}{
+		{
+			name:    "done",
+			results: `{"source":"https://example.org/a","urls":["https://telegra.ph/A"]}` + "\n",
+			done:    map[string]bool{"https://example.org/a": true},
+		},
+		{
+			name: "failed",
+			results: `{"source":"https://example.org/a","urls":[],"error":{"type":"screenshot","message":"failed"}}` + "\n" +
+				`{"source":"https://example.org/b","urls":[]}` + "\n",
+			done: map[string]bool{},
+		},
+		{
+			name: "partially written",
+			results: `{"source":"https://example.org/a","urls":["https://telegra.ph/A"]}` + "\n" +
+				`{"source":"https://example.org/b","urls":["https://tel`,
+			done: map[string]bool{"https://example.org/a": true},
+		},
+		{
+			name: "cut line followed by results",
+			results: `{"source":"https://example.org/a","ur` + "\n" +
+				`{"source":"https://example.org/b","urls":["https://telegra.ph/B"]}` + "\n",
+			done: map[string]bool{"https://example.org/b": true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "done.jsonl")
+			if err := os.WriteFile(path, []byte(test.results), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			done, err := loadDone(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(done, test.done) {
+				t.Errorf("Unexpected done, got %v instead of %v", done, test.done)
+			}
+		})
+	}
+
+	done, err := loadDone(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil || len(done) != 0 {
+		t.Errorf("Unexpected done of a missing file, got %v, %v", done, err)
+	}
+}
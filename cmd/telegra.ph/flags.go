@@ -0,0 +1,169 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wabarc/logger"
+	"github.com/wabarc/telegra.ph"
+)
+
+// Flags default to the environment variable named in their usage.
+var (
+	browser   = flag.String("browser", os.Getenv("TELEGRAPH_BROWSER"), "remote headless browser address, e.g. 127.0.0.1:9222, env TELEGRAPH_BROWSER")
+	token     = flag.String("token", os.Getenv(ph.EnvAccessToken), "access token of the Telegraph account, env "+ph.EnvAccessToken)
+	tokenFile = flag.String("token-file", os.Getenv("TELEGRAPH_TOKEN_FILE"), "file the Telegraph account is loaded from and saved to, env TELEGRAPH_TOKEN_FILE")
+
+	authorName  = flag.String("author", os.Getenv("TELEGRAPH_AUTHOR"), "author name of pages, env TELEGRAPH_AUTHOR")
+	authorURL   = flag.String("author-url", os.Getenv("TELEGRAPH_AUTHOR_URL"), "author URL of pages, env TELEGRAPH_AUTHOR_URL")
+	authorShort = flag.String("author-short-name", os.Getenv("TELEGRAPH_AUTHOR_SHORT_NAME"), "short name of a new Telegraph account, env TELEGRAPH_AUTHOR_SHORT_NAME")
+	brand       = flag.Bool("brand", envBool("TELEGRAPH_BRAND"), "credit pages to the author instead of the source, env TELEGRAPH_BRAND")
+
+	mode        = flag.String("mode", os.Getenv("TELEGRAPH_MODE"), "what to publish: full, article or screenshot, env TELEGRAPH_MODE")
+	timeout     = flag.Duration("timeout", envDuration("TELEGRAPH_TIMEOUT", time.Minute), "timeout of each URL, file or page command, env TELEGRAPH_TIMEOUT")
+	httpTimeout = flag.Duration("http-timeout", envDuration("TELEGRAPH_HTTP_TIMEOUT", 30*time.Second), "timeout of each HTTP request, env TELEGRAPH_HTTP_TIMEOUT")
+	retries     = flag.Int("retries", envInt("TELEGRAPH_RETRIES", int(ph.DefaultRetryPolicy.MaxRetries)), "retries of transient failures, env TELEGRAPH_RETRIES")
+
+	concurrency     = flag.Int("concurrency", envInt("TELEGRAPH_CONCURRENCY", 0), "images transferred at once, env TELEGRAPH_CONCURRENCY")
+	hostConcurrency = flag.Int("host-concurrency", envInt("TELEGRAPH_HOST_CONCURRENCY", 0), "images downloaded at once from a host, env TELEGRAPH_HOST_CONCURRENCY")
+	uploaders       = flag.String("uploaders", envString("TELEGRAPH_UPLOADERS", "telegraph,imgbb"), "image hosts tried in order, env TELEGRAPH_UPLOADERS")
+	imgbbKey        = flag.String("imgbb-key", os.Getenv("TELEGRAPH_IMGBB_KEY"), "ImgBB API key, env TELEGRAPH_IMGBB_KEY")
+	imageCache      = flag.String("cache", os.Getenv("TELEGRAPH_CACHE"), "file transferred images are cached in, env TELEGRAPH_CACHE")
+	tileHeight      = flag.Int("tile-height", envInt("TELEGRAPH_TILE_HEIGHT", 0), "height screenshots are sliced to, env TELEGRAPH_TILE_HEIGHT")
+	tileFormat      = flag.String("tile-format", envString("TELEGRAPH_TILE_FORMAT", string(ph.PNG)), "encoding of screenshot slices: png or jpeg, env TELEGRAPH_TILE_FORMAT")
+
+	apiURL    = flag.String("api-url", os.Getenv("TELEGRAPH_API_URL"), "base URL of the Telegraph API, env TELEGRAPH_API_URL")
+	uploadURL = flag.String("upload-url", os.Getenv("TELEGRAPH_UPLOAD_URL"), "URL images are uploaded to, env TELEGRAPH_UPLOAD_URL")
+	proxy     = flag.String("proxy", os.Getenv("TELEGRAPH_PROXY"), "proxy URL of HTTP requests, env TELEGRAPH_PROXY")
+
+	output   = flag.String("output", envString("TELEGRAPH_OUTPUT", "text"), "output of archived URLs: text, or json for a JSON object per line, env TELEGRAPH_OUTPUT")
+	input    = flag.String("input", "", "file of URLs to archive, one per line, - for stdin")
+	parallel = flag.Int("parallel", envInt("TELEGRAPH_PARALLEL", 4), "URLs archived at once, env TELEGRAPH_PARALLEL")
+	ordered  = flag.Bool("ordered", false, "print results in input order instead of as they finish")
+	results  = flag.String("results", os.Getenv("TELEGRAPH_RESULTS"), "file results are appended to as JSON lines, URLs done in it are skipped, env TELEGRAPH_RESULTS")
+
+	debug = flag.Bool("debug", envBool("DEBUG"), "print debug messages, env DEBUG")
+)
+
+// options returns the archiver options given by flags, cleanup releases the
+// resources they hold once the archiver is done.
+func options() (opts []ph.Option, cleanup func(), err error) {
+	cleanup = func() {}
+	if *output != "text" && *output != "json" {
+		return nil, cleanup, errors.Errorf("unknown output %q", *output)
+	}
+	if *retries < 0 {
+		return nil, cleanup, errors.Errorf("invalid retries %d", *retries)
+	}
+	if *debug {
+		logger.EnableDebug()
+	}
+
+	client := &http.Client{Timeout: *httpTimeout}
+	if *proxy != "" {
+		u, err := url.Parse(*proxy)
+		if err != nil {
+			return nil, cleanup, errors.Wrap(err, "invalid proxy")
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(u)
+		client.Transport = transport
+	}
+
+	policy := ph.DefaultRetryPolicy
+	policy.MaxRetries = uint64(*retries)
+	opts = []ph.Option{
+		ph.WithHTTPClient(client),
+		ph.WithTelegraphClient(client),
+		ph.WithBaseURL(*apiURL),
+		ph.WithUploadURL(*uploadURL),
+		ph.WithBrowserRemote(*browser),
+		// Pages can only be updated with the account that created them.
+		ph.WithAccessToken(*token),
+		ph.WithAuthor(ph.Author{ShortName: *authorShort, Name: *authorName, URL: *authorURL, Brand: *brand}),
+		ph.WithRetryPolicy(policy),
+		ph.WithConcurrency(*concurrency),
+		ph.WithHostConcurrency(*hostConcurrency),
+		ph.WithTileHeight(*tileHeight),
+	}
+	if *tokenFile != "" {
+		opts = append(opts, ph.WithAccountStore(ph.NewFileStore(*tokenFile)))
+	}
+
+	switch format := ph.ImageFormat(strings.ToLower(*tileFormat)); format {
+	case ph.PNG, ph.JPEG:
+		opts = append(opts, ph.WithTileFormat(format))
+	case "jpg":
+		opts = append(opts, ph.WithTileFormat(ph.JPEG))
+	default:
+		return nil, cleanup, errors.Errorf("unknown tile format %q", *tileFormat)
+	}
+
+	var hosts []ph.ImageUploader
+	for _, name := range strings.Split(*uploaders, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "telegraph":
+			hosts = append(hosts, &ph.TelegraphUploader{Client: client, Endpoint: *uploadURL})
+		case "imgbb":
+			hosts = append(hosts, ph.NewImgBBUploader(client, *imgbbKey))
+		case "":
+		default:
+			return nil, cleanup, errors.Errorf("unknown image host %q", name)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, cleanup, errors.New("no image host")
+	}
+	opts = append(opts, ph.WithImageUploaders(hosts...))
+
+	if *imageCache != "" {
+		cache, err := ph.NewFileCache(*imageCache)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { cache.(io.Closer).Close() } // nolint:errcheck
+		opts = append(opts, ph.WithImageCache(cache))
+	}
+
+	return opts, cleanup, nil
+}
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+	return def
+}
+
+func envBool(key string) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "on", "yes":
+		return true
+	}
+	return false
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return def
+}
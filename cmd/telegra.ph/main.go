@@ -10,8 +10,6 @@ import (
 	"fmt"
 	"net/url"
 	"os"
-	"sync"
-	"time"
 
 	"github.com/pkg/errors"
 	"github.com/wabarc/telegra.ph"
@@ -21,39 +19,140 @@ func main() {
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) < 1 {
-		flag.Usage()
-		e := os.Args[0]
-		fmt.Printf("  %s url [url]\n\n", e)
-		fmt.Printf("example:\n  %s https://www.eff.org/ https://www.fsf.org/\n\n", e)
+	if len(args) < 1 && *input == "" {
+		usage()
 		os.Exit(1)
 	}
 
-	wbrc := ph.New(nil)
-	process(wbrc.Wayback, args)
+	opts, cleanup, err := options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	m, err := ph.ParseMode(*mode)
+	if err != nil {
+		cleanup()
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ok := run(ph.New(opts...), m, args)
+	cleanup()
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// run runs the command of args, it reports whether the command succeeded.
+func run(wbrc *ph.Archiver, m ph.Mode, args []string) bool {
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	var err error
+	switch name {
+	case "publish":
+		if len(args) < 2 {
+			usage()
+			return false
+		}
+		return publish(wbrc.PublishMarkdown, args[1:])
+	case "update":
+		if len(args) != 3 {
+			usage()
+			return false
+		}
+		return update(func(ctx context.Context, page string, u *url.URL) ([]string, error) {
+			return wbrc.Update(wbrc.WithMode(ctx, m), page, u)
+		}, args[1], args[2])
+	case "list", "get", "views":
+		err = pages(wbrc, name, args[1:])
+	case "serve":
+		err = serve(wbrc, m, args[1:])
+	case "queue":
+		err = queueCmd(wbrc, m, args[1:])
+	case "export":
+		err = export(wbrc, args[1:])
+	default:
+		var links []string
+		if links, err = readInput(*input, args); err != nil {
+			break
+		}
+		var ok bool
+		ok, err = process(func(ctx context.Context, u *url.URL) (*ph.Result, error) {
+			return wbrc.Archive(wbrc.WithMode(ctx, m), u)
+		}, links)
+		if err == nil && !ok {
+			return false
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	return true
+}
+
+func usage() {
+	flag.Usage()
+	e := os.Args[0]
+	fmt.Printf("  %s [-output text|json] url [url]\n", e)
+	fmt.Printf("  %s [-parallel n] [-ordered] [-results file] -input file|- [url]\n", e)
+	fmt.Printf("  %s publish file.md [file.md]\n", e)
+	fmt.Printf("  %s update telegraph-url source-url\n", e)
+	fmt.Printf("  %s list [-output table|json]\n", e)
+	fmt.Printf("  %s get [-output table|json] telegraph-url\n", e)
+	fmt.Printf("  %s views [-output table|json] telegraph-url [2006|2006-01|2006-01-02|2006-01-02T15]\n", e)
+	fmt.Printf("  %s serve [-addr :8080] [-workers n]\n", e)
+	fmt.Printf("  %s queue add [-file queue.jsonl] [-input file|-] [url]\n", e)
+	fmt.Printf("  %s queue run [-file queue.jsonl] [-workers n] [-attempts n] [-drain]\n", e)
+	fmt.Printf("  %s queue list [-file queue.jsonl] [-output table|json]\n", e)
+	fmt.Printf("  %s export [-format html|markdown|json] [-images dir] [-o file] telegraph-url\n\n", e)
+	fmt.Printf("example:\n  %s https://www.eff.org/ https://www.fsf.org/\n", e)
+	fmt.Printf("  %s -parallel 4 -results done.jsonl -input urls.txt\n", e)
+	fmt.Printf("  %s publish CHANGELOG.md\n", e)
+	fmt.Printf("  %s update https://telegra.ph/Front-Page-01-27 https://www.fsf.org/\n\n", e)
+}
+
+// publish publishes the files, it reports whether all files were published.
+func publish(f func(context.Context, string) ([]string, error), files []string) bool {
+	ok := true
+	for _, file := range files {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		r, err := f(ctx, file)
+		cancel()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, file, "=>", fmt.Sprintf("%v", errors.WithStack(err)))
+			ok = false
+			continue
+		}
+		for _, dst := range r {
+			fmt.Println(file, "=>", dst)
+		}
+	}
+
+	return ok
 }
 
-func process(f func(context.Context, *url.URL) (string, error), args []string) {
-	var wg sync.WaitGroup
-	for _, arg := range args {
-		wg.Add(1)
-		go func(link string) {
-			defer wg.Done()
-			u, err := url.Parse(link)
-			if err != nil {
-				fmt.Println(link, "=>", fmt.Sprintf("%v", errors.WithStack(err)))
-				return
-			}
-			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-			defer cancel()
-
-			r, err := f(ctx, u)
-			if err != nil {
-				fmt.Println(link, "=>", fmt.Sprintf("%v", errors.WithStack(err)))
-				return
-			}
-			fmt.Println(link, "=>", r)
-		}(arg)
-	}
-	wg.Wait()
+// update updates the page with the link, it reports whether the page was updated.
+func update(f func(context.Context, string, *url.URL) ([]string, error), page, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, link, "=>", fmt.Sprintf("%v", errors.WithStack(err)))
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	r, err := f(ctx, page, u)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, link, "=>", fmt.Sprintf("%v", errors.WithStack(err)))
+		return false
+	}
+	for _, dst := range r {
+		fmt.Println(link, "=>", dst)
+	}
+
+	return true
 }
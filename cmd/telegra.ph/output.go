@@ -0,0 +1,77 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wabarc/telegra.ph"
+)
+
+// printer writes results of concurrent jobs as text or JSON lines, in the order
+// the jobs were queued if ordered. Results are also recorded to the record writer
+// as JSON lines, as soon as they are done.
+type printer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	json    bool
+	ordered bool
+	record  io.Writer
+
+	next    int
+	pending map[int]pendingResult
+}
+
+type pendingResult struct {
+	source string
+	res    *ph.Result
+	err    error
+}
+
+// print prints the result of the i-th job, i counts from 0.
+func (p *printer) print(i int, source string, res *ph.Result, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.record != nil {
+		json.NewEncoder(p.record).Encode(ph.NewReport(source, res, err)) // nolint:errcheck
+	}
+	if !p.ordered {
+		p.write(source, res, err)
+		return
+	}
+
+	if p.pending == nil {
+		p.pending = make(map[int]pendingResult)
+	}
+	p.pending[i] = pendingResult{source: source, res: res, err: err}
+	for {
+		r, ok := p.pending[p.next]
+		if !ok {
+			return
+		}
+		delete(p.pending, p.next)
+		p.next++
+		p.write(r.source, r.res, r.err)
+	}
+}
+
+func (p *printer) write(source string, res *ph.Result, err error) {
+	if p.json {
+		json.NewEncoder(p.w).Encode(ph.NewReport(source, res, err)) // nolint:errcheck
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(p.w, source, "=>", fmt.Sprintf("%v", errors.WithStack(err)))
+		return
+	}
+	for _, dst := range res.URLs {
+		fmt.Fprintln(p.w, source, "=>", dst)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/wabarc/telegra.ph"
+)
+
+func TestPrinter(t *testing.T) {
+	// Jobs finish out of order, the second one failing last.
+	arrival := []int{2, 0, 3, 1}
+	sources := []string{"https://example.org/0", "https://example.org/1", "https://example.org/2", "https://example.org/3"}
+
+	tests := []struct {
+		name    string
+		ordered bool
+		json    bool
+		output  string
+	}{
+		{
+			name:   "unordered",
+			output: "https://example.org/2 => https://telegra.ph/2\nhttps://example.org/0 => https://telegra.ph/0\nhttps://example.org/3 => https://telegra.ph/3\nhttps://example.org/1 => unreachable\n",
+		},
+		{
+			name:    "ordered",
+			ordered: true,
+			output:  "https://example.org/0 => https://telegra.ph/0\nhttps://example.org/1 => unreachable\nhttps://example.org/2 => https://telegra.ph/2\nhttps://example.org/3 => https://telegra.ph/3\n",
+		},
+		{
+			name:    "ordered json",
+			ordered: true,
+			json:    true,
+			output: `{"source":"https://example.org/0","urls":["https://telegra.ph/0"],"images":[],"timings_ms":{}}` + "\n" +
+				`{"source":"https://example.org/1","urls":[],"images":[],"timings_ms":{},"error":{"type":"error","message":"unreachable"}}` + "\n" +
+				`{"source":"https://example.org/2","urls":["https://telegra.ph/2"],"images":[],"timings_ms":{}}` + "\n" +
+				`{"source":"https://example.org/3","urls":["https://telegra.ph/3"],"images":[],"timings_ms":{}}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out, record bytes.Buffer
+			p := &printer{w: &out, json: test.json, ordered: test.ordered, record: &record}
+			for _, i := range arrival {
+				if i == 1 {
+					p.print(i, sources[i], nil, errors.New("unreachable"))
+					continue
+				}
+				p.print(i, sources[i], &ph.Result{URLs: []string{"https://telegra.ph/" + sources[i][len(sources[i])-1:]}}, nil)
+			}
+
+			if got := out.String(); got != test.output {
+				t.Errorf("Unexpected output, got %q instead of %q", got, test.output)
+			}
+
+			// Results are recorded as they arrive.
+			var recorded []string
+			dec := json.NewDecoder(&record)
+			for dec.More() {
+				var r struct{ Source string }
+				if err := dec.Decode(&r); err != nil {
+					t.Fatal(err)
+				}
+				recorded = append(recorded, r.Source)
+			}
+			if want := "https://example.org/2 https://example.org/0 https://example.org/3 https://example.org/1"; strings.Join(recorded, " ") != want {
+				t.Errorf("Unexpected records, got %v instead of %s", recorded, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kallydev/telegraph-go"
+	"github.com/pkg/errors"
+	"github.com/wabarc/telegra.ph"
+)
+
+// pages runs the list, get and views subcommands.
+func pages(wbrc *ph.Archiver, name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	output := fs.String("output", "table", "output format, table or json")
+	fs.Parse(args) // nolint:errcheck
+	args = fs.Args()
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch name {
+	case "list":
+		pages, err := wbrc.Pages(ctx)
+		if errors.Is(err, ph.ErrNoAccount) {
+			return errors.New("no account configured, set -token or -token-file")
+		}
+		if err != nil {
+			return err
+		}
+		if *output == "json" {
+			return writeJSON(os.Stdout, pages)
+		}
+		return writePages(os.Stdout, pages)
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s get [-output table|json] page", os.Args[0])
+		}
+		page, err := wbrc.Page(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if *output == "json" {
+			return writeJSON(os.Stdout, page)
+		}
+		return writePage(os.Stdout, page)
+	case "views":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: %s views [-output table|json] page [period]", os.Args[0])
+		}
+		var period string
+		if len(args) == 2 {
+			period = args[1]
+		}
+		views, err := wbrc.Views(ctx, args[0], period)
+		if err != nil {
+			return err
+		}
+		if *output == "json" {
+			return writeJSON(os.Stdout, map[string]interface{}{"page": args[0], "period": period, "views": views})
+		}
+		if period == "" {
+			period = "total"
+		}
+		fmt.Printf("%s\t%s\t%d\n", args[0], period, views)
+	}
+
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writePages(w io.Writer, pages []telegraph.Page) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tTITLE\tVIEWS\tURL")
+	for _, page := range pages {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", page.Path, page.Title, page.Views, page.URL)
+	}
+	return tw.Flush()
+}
+
+func writePage(w io.Writer, page *telegraph.Page) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Path:\t%s\n", page.Path)
+	fmt.Fprintf(tw, "URL:\t%s\n", page.URL)
+	fmt.Fprintf(tw, "Title:\t%s\n", page.Title)
+	fmt.Fprintf(tw, "Author:\t%s\n", page.AuthorName)
+	fmt.Fprintf(tw, "Views:\t%d\n", page.Views)
+	fmt.Fprintf(tw, "Nodes:\t%d\n", len(page.Content))
+	fmt.Fprintf(tw, "Description:\t%s\n", page.Description)
+	return tw.Flush()
+}
+
+// export runs the export subcommand.
+func export(wbrc *ph.Archiver, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "html", "export format, html, markdown or json")
+	images := fs.String("images", "", "download images to the directory")
+	out := fs.String("o", "", "write to the file instead of stdout")
+	fs.Parse(args) // nolint:errcheck
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s export [-format html|markdown|json] [-images dir] [-o file] page", os.Args[0])
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	return wbrc.Export(ctx, fs.Arg(0), w, ph.ExportOptions{Format: ph.ExportFormat(*format), ImageDir: *images})
+}
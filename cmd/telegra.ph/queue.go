@@ -0,0 +1,97 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/wabarc/telegra.ph"
+	"github.com/wabarc/telegra.ph/queue"
+)
+
+// queueCmd runs the queue add, run and list subcommands.
+func queueCmd(wbrc *ph.Archiver, mode ph.Mode, args []string) error {
+	usage := fmt.Errorf("usage: %s queue add|run|list [-file queue.jsonl] ...", os.Args[0])
+	if len(args) < 1 {
+		return usage
+	}
+
+	fs := flag.NewFlagSet("queue "+args[0], flag.ExitOnError)
+	file := fs.String("file", envString("TELEGRAPH_QUEUE", "queue.jsonl"), "file the queue is kept in, env TELEGRAPH_QUEUE")
+	in := fs.String("input", "", "file of URLs to add, one per line, - for stdin")
+	workers := fs.Int("workers", envInt("TELEGRAPH_WORKERS", 4), "URLs archived at once, env TELEGRAPH_WORKERS")
+	attempts := fs.Int("attempts", 5, "attempts of a URL before it is marked failed")
+	drain := fs.Bool("drain", false, "exit once no URL is pending instead of waiting for more")
+	out := fs.String("output", "table", "output format, table or json")
+	fs.Parse(args[1:]) // nolint:errcheck
+
+	q, err := queue.OpenFile(*file)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	switch args[0] {
+	case "add":
+		links, err := readInput(*in, fs.Args())
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("invalid url %q", link)
+			}
+			item, err := q.Enqueue(link)
+			if err != nil {
+				return err
+			}
+			fmt.Println(item.ID, item.URL)
+		}
+	case "run":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		w := queue.NewWorker(q, wbrc,
+			queue.WithWorkers(*workers),
+			queue.WithMaxAttempts(*attempts),
+			queue.WithTimeout(*timeout),
+			queue.WithMode(mode),
+		)
+		if *drain {
+			return w.Drain(ctx)
+		}
+		return w.Run(ctx)
+	case "list":
+		items, err := q.List()
+		if err != nil {
+			return err
+		}
+		if *out == "json" {
+			return writeJSON(os.Stdout, items)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATUS\tATTEMPTS\tURL\tRESULT")
+		for _, item := range items {
+			result := strings.Join(item.Result, " ")
+			if item.Status == queue.StatusFailed {
+				result = item.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", item.ID, item.Status, item.Attempts, item.URL, result)
+		}
+		return tw.Flush()
+	default:
+		return usage
+	}
+
+	return nil
+}
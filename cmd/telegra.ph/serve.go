@@ -0,0 +1,50 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/wabarc/telegra.ph"
+	"github.com/wabarc/telegra.ph/server"
+)
+
+// serve runs the serve subcommand until interrupted.
+func serve(wbrc *ph.Archiver, mode ph.Mode, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", envString("TELEGRAPH_ADDR", ":8080"), "address to listen on, env TELEGRAPH_ADDR")
+	workers := fs.Int("workers", envInt("TELEGRAPH_WORKERS", 4), "asynchronous archives run at once, env TELEGRAPH_WORKERS")
+	fs.Parse(args) // nolint:errcheck
+
+	srv := server.New(wbrc, server.WithWorkers(*workers), server.WithTimeout(*timeout), server.WithMode(mode))
+	defer srv.Close()
+
+	hs := &http.Server{Addr: *addr, Handler: srv}
+	errc := make(chan error, 1)
+	go func() {
+		fmt.Fprintln(os.Stderr, "listening on", *addr)
+		errc <- hs.ListenAndServe()
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		return err
+	case <-sig:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return hs.Shutdown(ctx)
+}
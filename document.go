@@ -0,0 +1,65 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kallydev/telegraph-go"
+	"github.com/pkg/errors"
+)
+
+// Document is content captured elsewhere, published by Publish as is.
+type Document struct {
+	// Title is the page title, required.
+	Title string
+
+	// URL is the source URL of the content.
+	URL string
+
+	// HTML is the content, ignored if Nodes is set.
+	HTML string
+
+	// Nodes is the content as Telegraph nodes, it is sanitized like HTML.
+	Nodes []telegraph.Node
+
+	// Screenshots are local image files or URLs of uploaded images, local files
+	// are sliced and uploaded. They are linked above the content, or make up the
+	// page if there is no content.
+	Screenshots []string
+
+	// Author overrides the author of the archiver if set.
+	Author *Author
+}
+
+// Publish publishes the document to telegra.ph without capturing the webpage, images
+// of the content are transferred like Wayback does. It returns the URLs of the pages,
+// more than one if the content is too large for a single page.
+func (arc *Archiver) Publish(ctx context.Context, doc Document) ([]string, error) {
+	if _, err := arc.dial(ctx); err != nil {
+		return nil, newError(ErrAccount, doc.URL, err)
+	}
+
+	return arc.postDocument(ctx, doc, nil)
+}
+
+// postDocument posts the document, overwriting the existing page if not nil.
+func (arc *Archiver) postDocument(ctx context.Context, doc Document, page *telegraph.Page) ([]string, error) {
+	nodes := doc.Nodes
+	if len(nodes) == 0 && strings.TrimSpace(doc.HTML) != "" {
+		nodes = arc.parseNodes(doc.HTML)
+	}
+	if len(nodes) == 0 && len(doc.Screenshots) == 0 {
+		return nil, newError(ErrCreatePage, doc.URL, errors.New("empty document"))
+	}
+
+	sub := subject{title: []rune(strings.TrimSpace(doc.Title)), source: doc.URL, author: arc.Author, page: page}
+	if doc.Author != nil {
+		sub.author = *doc.Author
+	}
+
+	return arc.post(ctx, sub, nodes, doc.Screenshots)
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	arc, srv := newTestArchiver(t)
+
+	dsts, err := arc.Publish(context.Background(), Document{
+		Title:       "Testing",
+		URL:         "https://example.org/",
+		HTML:        `<h1>Heading</h1><p>Hello <script>alert(1)</script>world</p>`,
+		Screenshots: []string{"https://telegra.ph/file/shot.png"},
+		Author:      &Author{Name: "Tester"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := srv.Pages()
+	if len(dsts) != 1 || len(pages) != 1 || dsts[0] != pages[0].URL {
+		t.Fatalf("Unexpected pages, got %v", dsts)
+	}
+	if pages[0].AuthorName != "Source" {
+		t.Errorf("Unexpected author, got %s instead of Source", pages[0].AuthorName)
+	}
+
+	buf, _ := json.Marshal(pages[0].Content)
+	content := string(buf)
+	for _, want := range []string{`"h3"`, `Hello `, `https://telegra.ph/file/shot.png`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Unexpected content, %s not found in %s", want, content)
+		}
+	}
+	if strings.Contains(content, "alert") {
+		t.Errorf("Unexpected content, script not removed in %s", content)
+	}
+}
+
+func TestPublishEmptyDocument(t *testing.T) {
+	arc := New()
+	arc.client = newAPI(nil, "token", testRetryPolicy, nil)
+
+	_, err := arc.Publish(context.Background(), Document{Title: "Testing"})
+	if !errors.Is(err, ErrCreatePage) {
+		t.Errorf("Unexpected error, got %v instead of %v", err, ErrCreatePage)
+	}
+}
+
+func TestPublishFakeServer(t *testing.T) {
+	arc, srv := newTestArchiver(t)
+
+	srv.FloodWait(2, 0)
+	dsts, err := arc.Publish(context.Background(), Document{
+		Title: "Testing",
+		URL:   "https://example.org/",
+		HTML:  `<p>Hello world</p>`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := srv.Pages()
+	if len(dsts) != 1 || len(pages) != 1 || dsts[0] != pages[0].URL {
+		t.Fatalf("Unexpected pages, got %v", dsts)
+	}
+	if pages[0].Title != "Testing" {
+		t.Errorf("Unexpected title, got %s instead of Testing", pages[0].Title)
+	}
+
+	srv.FloodWait(10, 0)
+	_, err = arc.Publish(context.Background(), Document{Title: "Testing", HTML: `<p>Hello world</p>`})
+	var fw *ErrFloodWait
+	if !errors.As(err, &fw) || !errors.Is(err, ErrCreatePage) {
+		t.Errorf("Unexpected error, got %v", err)
+	}
+}
+
+func TestPublishCreatePageFailure(t *testing.T) {
+	arc, srv := newTestArchiver(t)
+	if _, err := arc.Account(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	doc := Document{Title: "Testing", HTML: `<p>Hello world</p>`}
+
+	srv.FailNext(1, "CONTENT_TOO_BIG")
+	_, err := arc.Publish(context.Background(), doc)
+	if !errors.Is(err, ErrContentTooLarge) || !errors.Is(err, ErrCreatePage) {
+		t.Errorf("Unexpected error, got %v instead of %v", err, ErrContentTooLarge)
+	}
+	if calls := srv.Calls("createPage"); calls != 1 {
+		t.Errorf("Unexpected calls of createPage, got %d instead of 1", calls)
+	}
+
+	// Pages titled illegally are created with a random title.
+	srv.FailNext(1, "TITLE_INVALID")
+	dsts, err := arc.Publish(context.Background(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := srv.Calls("createPage"); calls != 3 {
+		t.Errorf("Unexpected calls of createPage, got %d instead of 3", calls)
+	}
+	if len(dsts) != 1 || !strings.HasSuffix(dsts[0], "?title=Testing") {
+		t.Errorf("Unexpected pages, got %v", dsts)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Stages of archiving, a failed stage is reported as an *Error matching one of them with errors.Is.
+var (
+	ErrAccount     = errors.New("telegraph account unavailable")
+	ErrScreenshot  = errors.New("screenshot failed")
+	ErrCapture     = errors.New("capture webpage failed")
+	ErrReadability = errors.New("extract article failed")
+	ErrUpload      = errors.New("upload image failed")
+	ErrCreatePage  = errors.New("create page failed")
+	ErrEditPage    = errors.New("edit page failed")
+)
+
+// Errors reported by the Telegraph API, matched with errors.Is.
+var (
+	ErrTitleInvalid    = errors.New("title invalid")
+	ErrContentTooLarge = errors.New("content too large")
+	ErrPageNotFound    = errors.New("page not found")
+	ErrAccessDenied    = errors.New("page access denied")
+)
+
+// ErrFloodWait is reported when Telegraph rate limits the account, RetryAfter is the
+// wait required before the next call. Match it with errors.As.
+type ErrFloodWait struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrFloodWait) Error() string {
+	return fmt.Sprintf("flood wait, retry after %s", e.RetryAfter)
+}
+
+// Error is a failure of archiving or publishing a webpage, it carries the stage that failed
+// and the input URL.
+type Error struct {
+	// Stage is the sentinel of the failed stage, e.g. ErrScreenshot.
+	Stage error
+
+	// URL is the input URL.
+	URL string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func newError(stage error, input string, err error) error {
+	return &Error{Stage: stage, URL: input, Err: err}
+}
+
+func (e *Error) Error() string {
+	msg := e.Stage.Error()
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.URL != "" {
+		msg = e.URL + ": " + msg
+	}
+	return msg
+}
+
+// Is reports whether target is the stage of the error.
+func (e *Error) Is(target error) bool {
+	return target == e.Stage
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// apiError is an error reported by the Telegraph API, e.g. TITLE_INVALID.
+type apiError struct {
+	method  string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("telegraph %s: %s", e.method, e.message)
+}
+
+// Is maps the Telegraph error to the exported sentinels.
+func (e *apiError) Is(target error) bool {
+	switch target {
+	case ErrTitleInvalid:
+		return e.message == "TITLE_INVALID" || e.message == "TITLE_TOO_LONG"
+	case ErrContentTooLarge:
+		return e.message == "CONTENT_TOO_BIG"
+	case ErrPageNotFound:
+		return e.message == "PAGE_NOT_FOUND"
+	case ErrAccessDenied:
+		return e.message == "PAGE_ACCESS_DENIED"
+	}
+	return false
+}
+
+// As converts a FLOOD_WAIT_x error to an *ErrFloodWait.
+func (e *apiError) As(target interface{}) bool {
+	fw, ok := target.(**ErrFloodWait)
+	if !ok || !strings.HasPrefix(e.message, "FLOOD_WAIT_") {
+		return false
+	}
+	secs, _ := strconv.Atoi(strings.TrimPrefix(e.message, "FLOOD_WAIT_"))
+	*fw = &ErrFloodWait{RetryAfter: time.Duration(secs) * time.Second}
+
+	return true
+}
+
+// Temporary reports whether archiving failed with err may succeed if tried again later:
+// network failures, timeouts, Telegraph flood control, and failures of the screenshot,
+// capture, upload and account stages. Errors reported by the Telegraph API, e.g.
+// ErrTitleInvalid, and pages without an article are permanent.
+func Temporary(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	case retryable(err):
+		return true
+	}
+
+	var ae *apiError
+	if errors.As(err, &ae) || errors.Is(err, ErrReadability) {
+		return false
+	}
+	for _, stage := range []error{ErrScreenshot, ErrCapture, ErrUpload, ErrAccount} {
+		if errors.Is(err, stage) {
+			return true
+		}
+	}
+	return false
+}
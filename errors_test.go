@@ -0,0 +1,100 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorStage(t *testing.T) {
+	err := newError(ErrScreenshot, "https://example.com", context.DeadlineExceeded)
+
+	if !errors.Is(err, ErrScreenshot) {
+		t.Errorf("Unexpected errors.Is, got false instead of true")
+	}
+	if errors.Is(err, ErrCapture) {
+		t.Errorf("Unexpected errors.Is of other stage, got true instead of false")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected errors.Is of underlying error, got false instead of true")
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Unexpected errors.As, got false instead of true")
+	}
+	if e.URL != "https://example.com" {
+		t.Errorf("Unexpected URL, got %s instead of https://example.com", e.URL)
+	}
+	if !strings.HasPrefix(err.Error(), "https://example.com: screenshot failed: ") {
+		t.Errorf("Unexpected message, got %s", err.Error())
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		message string
+		target  error
+	}{
+		{"TITLE_INVALID", ErrTitleInvalid},
+		{"TITLE_TOO_LONG", ErrTitleInvalid},
+		{"CONTENT_TOO_BIG", ErrContentTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.message, func(t *testing.T) {
+			err := newError(ErrCreatePage, "", &apiError{method: "createPage", message: test.message})
+			if !errors.Is(err, test.target) {
+				t.Errorf("Unexpected errors.Is, got false instead of true")
+			}
+			if !errors.Is(err, ErrCreatePage) {
+				t.Errorf("Unexpected errors.Is of stage, got false instead of true")
+			}
+		})
+	}
+}
+
+func TestFloodWaitError(t *testing.T) {
+	err := newError(ErrCreatePage, "", &apiError{method: "createPage", message: "FLOOD_WAIT_7"})
+
+	var fw *ErrFloodWait
+	if !errors.As(err, &fw) {
+		t.Fatalf("Unexpected errors.As, got false instead of true")
+	}
+	if fw.RetryAfter != 7*time.Second {
+		t.Errorf("Unexpected retry after, got %s instead of 7s", fw.RetryAfter)
+	}
+	if errors.Is(err, ErrTitleInvalid) {
+		t.Errorf("Unexpected errors.Is, got true instead of false")
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		temp bool
+	}{
+		{"nil", nil, false},
+		{"canceled", newError(ErrScreenshot, "", context.Canceled), false},
+		{"deadline", newError(ErrScreenshot, "", context.DeadlineExceeded), true},
+		{"flood wait", newError(ErrCreatePage, "", &apiError{method: "createPage", message: "FLOOD_WAIT_7"}), true},
+		{"server error", newError(ErrCreatePage, "", &statusError{code: 502, status: "502 Bad Gateway"}), true},
+		{"title invalid", newError(ErrCreatePage, "", &apiError{method: "createPage", message: "TITLE_INVALID"}), false},
+		{"token invalid", newError(ErrAccount, "", &apiError{method: "createAccount", message: "ACCESS_TOKEN_INVALID"}), false},
+		{"no article", newError(ErrReadability, "", errors.New("no article found")), false},
+		{"screenshot", newError(ErrScreenshot, "", errors.New("screenshot error")), true},
+		{"unknown", errors.New("unknown"), false},
+	}
+	for _, test := range tests {
+		if temp := Temporary(test.err); temp != test.temp {
+			t.Errorf("Unexpected temporary of %s, got %t instead of %t", test.name, temp, test.temp)
+		}
+	}
+}
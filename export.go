@@ -0,0 +1,431 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kallydev/telegraph-go"
+	"github.com/pkg/errors"
+)
+
+// ExportFormat is the format pages are exported to.
+type ExportFormat string
+
+// Supported export formats.
+const (
+	ExportHTML     ExportFormat = "html"
+	ExportMarkdown ExportFormat = "markdown"
+	ExportJSON     ExportFormat = "json"
+)
+
+// ExportOptions controls how Export renders a page.
+type ExportOptions struct {
+	// Format of the export, defaults to ExportHTML.
+	Format ExportFormat
+
+	// ImageDir is the directory images of the page are downloaded to if set, the
+	// export refers to the downloaded images by their path joined with ImageDir.
+	ImageDir string
+}
+
+// Export fetches the page and writes it to w in the format of opts, page is the path
+// or the URL of the page.
+func (arc *Archiver) Export(ctx context.Context, page string, w io.Writer, opts ExportOptions) error {
+	p, err := arc.Page(ctx, page)
+	if err != nil {
+		return err
+	}
+	p.Content = absNodes(p.Content)
+
+	if opts.ImageDir != "" {
+		if err := os.MkdirAll(opts.ImageDir, 0755); err != nil {
+			return errors.Wrap(err, "create image directory failed")
+		}
+		names := make(map[string]bool)
+		if err := arc.downloadImages(ctx, p.Content, opts.ImageDir, names); err != nil {
+			return err
+		}
+	}
+
+	switch opts.Format {
+	case ExportHTML, "":
+		_, err = io.WriteString(w, RenderHTML(p))
+	case ExportMarkdown:
+		_, err = io.WriteString(w, RenderMarkdown(p))
+	case ExportJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(p)
+	default:
+		err = errors.Errorf("unknown export format %q", opts.Format)
+	}
+
+	return err
+}
+
+// absNodes returns a copy of nodes with links relative to telegra.ph made absolute.
+func absNodes(nodes []telegraph.Node) []telegraph.Node {
+	out := make([]telegraph.Node, 0, len(nodes))
+	for _, node := range nodes {
+		element, ok := node.(telegraph.NodeElement)
+		if !ok {
+			out = append(out, node)
+			continue
+		}
+		attrs := make(map[string]string, len(element.Attrs))
+		for k, v := range element.Attrs {
+			// Links of Telegraph pages are relative to telegra.ph, e.g. /file/abc.jpg
+			if (k == "src" || k == "href") && strings.HasPrefix(v, "/") && !strings.HasPrefix(v, "//") {
+				v = telegraphSite + v
+			}
+			attrs[k] = v
+		}
+		element.Attrs = attrs
+		element.Children = absNodes(element.Children)
+		out = append(out, element)
+	}
+
+	return out
+}
+
+// downloadImages downloads the images of nodes to dir and points them to the
+// downloaded files, names holds the file names taken.
+func (arc *Archiver) downloadImages(ctx context.Context, nodes []telegraph.Node, dir string, names map[string]bool) error {
+	for _, node := range nodes {
+		element, ok := node.(telegraph.NodeElement)
+		if !ok {
+			continue
+		}
+		if err := arc.downloadImages(ctx, element.Children, dir, names); err != nil {
+			return err
+		}
+		if element.Tag != "img" || element.Attrs["src"] == "" {
+			continue
+		}
+
+		u, err := url.Parse(element.Attrs["src"])
+		if err != nil {
+			return errors.Wrap(err, "parse image url failed")
+		}
+		tmp, err := arc.download(ctx, u)
+		if err != nil {
+			return errors.Wrapf(err, "download image %s failed", u)
+		}
+		data, err := os.ReadFile(tmp)
+		os.Remove(tmp)
+		if err != nil {
+			return err
+		}
+
+		name := uniqueName(path.Base(u.Path), names)
+		if err := os.WriteFile(filepath.Join(dir, name), data, perm); err != nil {
+			return errors.Wrap(err, "write image failed")
+		}
+		element.Attrs["src"] = filepath.ToSlash(filepath.Join(dir, name))
+	}
+
+	return nil
+}
+
+// uniqueName returns name, numbered if it is taken already.
+func uniqueName(name string, names map[string]bool) string {
+	if name == "" || name == "/" || name == "." {
+		name = "image"
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; names[name]; i++ {
+		name = base + "-" + strconv.Itoa(i) + ext
+	}
+	names[name] = true
+
+	return name
+}
+
+// RenderHTML renders the page to a standalone HTML document.
+func RenderHTML(page *telegraph.Page) string {
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(page.Title))
+	sb.WriteString("</head>\n<body>\n<article>\n")
+	fmt.Fprintf(&sb, "<h1>%s</h1>\n", html.EscapeString(page.Title))
+	if page.AuthorName != "" {
+		author := html.EscapeString(page.AuthorName)
+		if page.AuthorURL != "" {
+			author = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(page.AuthorURL), author)
+		}
+		fmt.Fprintf(&sb, "<address>%s</address>\n", author)
+	}
+	for _, node := range page.Content {
+		renderHTML(&sb, node)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("</article>\n</body>\n</html>\n")
+
+	return sb.String()
+}
+
+func renderHTML(sb *strings.Builder, node telegraph.Node) {
+	switch n := node.(type) {
+	case string:
+		sb.WriteString(html.EscapeString(n))
+	case telegraph.NodeElement:
+		sb.WriteString("<" + n.Tag)
+		keys := make([]string, 0, len(n.Attrs))
+		for k := range n.Attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(sb, " %s=\"%s\"", k, html.EscapeString(n.Attrs[k]))
+		}
+		sb.WriteString(">")
+		if n.Tag == "br" || n.Tag == "hr" || n.Tag == "img" {
+			return
+		}
+		for _, child := range n.Children {
+			renderHTML(sb, child)
+		}
+		sb.WriteString("</" + n.Tag + ">")
+	}
+}
+
+// RenderMarkdown renders the page to Markdown, titled by a top-level heading as
+// read back by ParseMarkdown.
+func RenderMarkdown(page *telegraph.Page) string {
+	var blocks []string
+	blocks = append(blocks, "# "+escapeMarkdown(page.Title))
+	for _, node := range page.Content {
+		if block := strings.TrimRight(markdownBlock(node), "\n "); strings.TrimSpace(block) != "" {
+			blocks = append(blocks, block)
+		}
+	}
+
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+func markdownBlock(node telegraph.Node) string {
+	element, ok := node.(telegraph.NodeElement)
+	if !ok || isInline(element) {
+		return markdownInline([]telegraph.Node{node})
+	}
+
+	switch element.Tag {
+	case "h3":
+		return "## " + markdownInline(element.Children)
+	case "h4":
+		return "### " + markdownInline(element.Children)
+	case "hr":
+		return "---"
+	case "pre":
+		code := strings.TrimRight(textContent(element.Children), "\n")
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + "\n" + code + "\n" + fence
+	case "blockquote", "aside":
+		lines := strings.Split(markdownBlocks(element.Children), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return strings.Join(lines, "\n")
+	case "ul", "ol":
+		return markdownList(element)
+	case "figure":
+		var img, caption string
+		for _, child := range element.Children {
+			c, ok := child.(telegraph.NodeElement)
+			if !ok {
+				continue
+			}
+			switch c.Tag {
+			case "img":
+				img = c.Attrs["src"]
+			case "iframe", "video":
+				img = c.Attrs["src"]
+				if img != "" {
+					return fmt.Sprintf("[%s](%s)", img, img)
+				}
+			case "figcaption":
+				caption = markdownInline(c.Children)
+			}
+		}
+		if img == "" {
+			return caption
+		}
+		return fmt.Sprintf("![%s](%s)", caption, img)
+	case "iframe", "video":
+		if src := element.Attrs["src"]; src != "" {
+			return fmt.Sprintf("[%s](%s)", src, src)
+		}
+		return ""
+	case "p", "figcaption", "li":
+		return markdownInline(element.Children)
+	}
+
+	return markdownBlocks(element.Children)
+}
+
+// markdownBlocks renders nodes that may mix block and inline elements.
+func markdownBlocks(nodes []telegraph.Node) string {
+	var blocks []string
+	var run []telegraph.Node
+	flush := func() {
+		if text := strings.TrimSpace(markdownInline(run)); text != "" {
+			blocks = append(blocks, text)
+		}
+		run = nil
+	}
+	for _, node := range nodes {
+		if element, ok := node.(telegraph.NodeElement); ok && !isInline(element) {
+			flush()
+			blocks = append(blocks, markdownBlock(element))
+			continue
+		}
+		run = append(run, node)
+	}
+	flush()
+
+	return strings.Join(blocks, "\n\n")
+}
+
+func markdownList(list telegraph.NodeElement) string {
+	var items []string
+	n := 0
+	for _, child := range list.Children {
+		item, ok := child.(telegraph.NodeElement)
+		if !ok || item.Tag != "li" {
+			continue
+		}
+		n++
+		marker := "- "
+		if list.Tag == "ol" {
+			marker = strconv.Itoa(n) + ". "
+		}
+		indent := strings.Repeat(" ", len(marker))
+
+		var inline []telegraph.Node
+		var nested []string
+		for _, node := range item.Children {
+			if element, ok := node.(telegraph.NodeElement); ok && (element.Tag == "ul" || element.Tag == "ol") {
+				nested = append(nested, markdownList(element))
+				continue
+			}
+			inline = append(inline, node)
+		}
+
+		lines := strings.Split(strings.TrimSpace(markdownInline(inline)), "\n")
+		for _, sub := range nested {
+			lines = append(lines, strings.Split(sub, "\n")...)
+		}
+		for i := range lines {
+			if i == 0 {
+				lines[i] = marker + lines[i]
+			} else if lines[i] != "" {
+				lines[i] = indent + lines[i]
+			}
+		}
+		items = append(items, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(items, "\n")
+}
+
+func markdownInline(nodes []telegraph.Node) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case string:
+			sb.WriteString(escapeMarkdown(n))
+		case telegraph.NodeElement:
+			text := markdownInline(n.Children)
+			switch n.Tag {
+			case "b", "strong":
+				sb.WriteString(wrapMarkdown(text, "**"))
+			case "i", "em":
+				sb.WriteString(wrapMarkdown(text, "*"))
+			case "s":
+				sb.WriteString(wrapMarkdown(text, "~~"))
+			case "code":
+				code := textContent(n.Children)
+				fence := "`"
+				for strings.Contains(code, fence) {
+					fence += "`"
+				}
+				sb.WriteString(fence + code + fence)
+			case "a":
+				if href := n.Attrs["href"]; href != "" {
+					fmt.Fprintf(&sb, "[%s](%s)", text, href)
+				} else {
+					sb.WriteString(text)
+				}
+			case "img":
+				fmt.Fprintf(&sb, "![%s](%s)", escapeMarkdown(n.Attrs["alt"]), n.Attrs["src"])
+			case "br":
+				sb.WriteString("  \n")
+			default:
+				if isInline(n) {
+					sb.WriteString(text)
+				} else {
+					sb.WriteString(markdownBlock(n))
+				}
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// wrapMarkdown wraps text in the emphasis delimiter, keeping surrounding spaces
+// outside of it.
+func wrapMarkdown(text, delim string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+
+	return lead + delim + trimmed + delim + trail
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `~`, `\~`, `<`, `\<`,
+)
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// textContent returns the text of nodes as is.
+func textContent(nodes []telegraph.Node) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case string:
+			sb.WriteString(n)
+		case telegraph.NodeElement:
+			if n.Tag == "br" {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(textContent(n.Children))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+func testPage() *telegraph.Page {
+	_, nodes := ParseMarkdown([]byte(strings.Join([]string{
+		"## Changes",
+		"Some text with a [link](https://example.org).",
+		"- one\n- two\n  - nested",
+		"1. first\n2. second",
+		"> quoted",
+		"```\nfunc main() {}\n```",
+		"---",
+		"![diagram](https://example.org/a.png)",
+	}, "\n\n")))
+
+	return &telegraph.Page{Title: "Release <1.2>", AuthorName: "Tester", Content: nodes}
+}
+
+// formatted is a paragraph of formatting that pages may hold but Markdown is not
+// parsed to.
+var formatted = telegraph.NodeElement{Tag: "p", Children: []telegraph.Node{
+	"Some ",
+	telegraph.NodeElement{Tag: "em", Children: []telegraph.Node{"em"}},
+	", ",
+	telegraph.NodeElement{Tag: "strong", Children: []telegraph.Node{"strong"}},
+	" and ",
+	telegraph.NodeElement{Tag: "code", Children: []telegraph.Node{"code"}},
+}}
+
+func TestRenderHTML(t *testing.T) {
+	page := testPage()
+	page.Content = append(page.Content, formatted)
+	got := RenderHTML(page)
+	for _, want := range []string{
+		`<title>Release &lt;1.2&gt;</title>`,
+		`<address>Tester</address>`,
+		`<h3>Changes</h3>`,
+		`<p>Some text with a <a href="https://example.org">link</a>.</p>`,
+		`<p>Some <em>em</em>, <strong>strong</strong> and <code>code</code></p>`,
+		`<ul><li>one</li><li>two<ul><li>nested</li></ul></li></ul>`,
+		`<pre>func main() {}</pre>`,
+		`<hr>`,
+		`<figure><img alt="diagram" src="https://example.org/a.png"><figcaption>diagram</figcaption></figure>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Unexpected HTML, %s not found in %s", want, got)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	page := testPage()
+	md := RenderMarkdown(page)
+	if !strings.HasPrefix(md, "# Release \\<1.2>\n\n## Changes\n") {
+		t.Errorf("Unexpected Markdown, got %s", md)
+	}
+
+	// Markdown rendered from a page reads back to the same page.
+	title, nodes := ParseMarkdown([]byte(md))
+	if title != page.Title {
+		t.Errorf("Unexpected title, got %s instead of %s", title, page.Title)
+	}
+	got, _ := json.Marshal(nodes)
+	want, _ := json.Marshal(page.Content)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Unexpected nodes, got %s instead of %s", got, want)
+	}
+
+	md = RenderMarkdown(&telegraph.Page{Title: "Formatted", Content: []telegraph.Node{formatted}})
+	if want := "Some *em*, **strong** and `code`"; !strings.Contains(md, want) {
+		t.Errorf("Unexpected Markdown, %s not found in %s", want, md)
+	}
+}
+
+// nolint:errcheck
+func TestExport(t *testing.T) {
+	img := genImage()
+	defer os.Remove(img.Name())
+	data, _ := os.ReadFile(img.Name())
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/getPage":
+			fmt.Fprintf(w, `{"ok":true,"result":{"path":"Page","title":"Page","content":[{"tag":"p","children":[{"tag":"a","attrs":{"href":"/Other"},"children":["other"]}]},{"tag":"img","attrs":{"src":"%s/file/a.png?orig=x"}}]}}`, ts.URL)
+		case "/file/a.png":
+			w.Write(data)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	arc := New(WithHTTPClient(ts.Client()), WithBaseURL(ts.URL), WithRetryPolicy(testRetryPolicy))
+
+	dir := filepath.Join(t.TempDir(), "images")
+	var buf bytes.Buffer
+	if err := arc.Export(context.Background(), "Page", &buf, ExportOptions{Format: ExportMarkdown, ImageDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# Page\n\n[other](https://telegra.ph/Other)\n\n![](" + filepath.ToSlash(filepath.Join(dir, "a.png")) + ")\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected export, got %q instead of %q", buf.String(), want)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.png")); !bytes.Equal(got, data) {
+		t.Errorf("Unexpected image downloaded, got %d bytes instead of %d", len(got), len(data))
+	}
+
+	buf.Reset()
+	if err := arc.Export(context.Background(), "Page", &buf, ExportOptions{Format: ExportJSON}); err != nil {
+		t.Fatal(err)
+	}
+	var page telegraph.Page
+	if err := json.Unmarshal(buf.Bytes(), &page); err != nil || page.Title != "Page" || len(page.Content) != 2 {
+		t.Errorf("Unexpected JSON export, got %s", buf.String())
+	}
+
+	if err := arc.Export(context.Background(), "Page", io.Discard, ExportOptions{Format: "pdf"}); err == nil {
+		t.Errorf("Unexpected export to unknown format")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	defaultConcurrency     = 8
+	defaultHostConcurrency = 4
+)
+
+// WithConcurrency sets the number of images transferred at once, shared by all
+// pages the archiver processes.
+func WithConcurrency(n int) Option {
+	return func(arc *Archiver) {
+		arc.concurrency = n
+	}
+}
+
+// WithHostConcurrency sets the number of images downloaded at once from the same origin server.
+func WithHostConcurrency(n int) Option {
+	return func(arc *Archiver) {
+		arc.hostConcurrency = n
+	}
+}
+
+// limiter bounds the number of concurrent transfers, in total and per host.
+type limiter struct {
+	mu    sync.Mutex
+	total chan struct{}
+	per   int
+	hosts map[string]chan struct{}
+}
+
+func newLimiter(total, per int) *limiter {
+	if total <= 0 {
+		total = defaultConcurrency
+	}
+	if per <= 0 {
+		per = defaultHostConcurrency
+	}
+
+	return &limiter{
+		total: make(chan struct{}, total),
+		per:   per,
+		hosts: make(map[string]chan struct{}),
+	}
+}
+
+// acquire takes a slot of the total limit, the returned function releases it.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	return take(ctx, l.total)
+}
+
+// acquireHost takes a slot of the limit of host, the returned function releases it.
+func (l *limiter) acquireHost(ctx context.Context, host string) (func(), error) {
+	l.mu.Lock()
+	sem, ok := l.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, l.per)
+		l.hosts[host] = sem
+	}
+	l.mu.Unlock()
+
+	return take(ctx, sem)
+}
+
+func take(ctx context.Context, sem chan struct{}) (func(), error) {
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-sem })
+	}, nil
+}
+
+// limiter returns the transfer limiter of the archiver, created on first use.
+func (arc *Archiver) limiter() *limiter {
+	arc.limiterOnce.Do(func() {
+		arc.limits = newLimiter(arc.concurrency, arc.hostConcurrency)
+	})
+	return arc.limits
+}
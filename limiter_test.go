@@ -0,0 +1,77 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1, 1)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected acquire on exhausted limiter, got error %v", err)
+	}
+
+	release()
+	release()
+	if _, err := l.acquire(context.Background()); err != nil {
+		t.Errorf("Unexpected acquire on released limiter, got error %v", err)
+	}
+}
+
+// nolint:errcheck
+func TestTransferImagesHostConcurrency(t *testing.T) {
+	var current, peak int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, "image")
+	}))
+	defer ts.Close()
+
+	uploader := uploaderFunc(func(_ context.Context, r io.Reader, _ string) (string, error) {
+		return "https://example.org/uploaded.png", nil
+	})
+	arc := New(WithImageUploaders(uploader), WithConcurrency(8), WithHostConcurrency(2))
+
+	var nodes []telegraph.Node
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, telegraph.NodeElement{Tag: "img", Attrs: map[string]string{"src": fmt.Sprintf("%s/%d.png", ts.URL, i)}})
+	}
+	arc.transferImages(context.Background(), nodes)
+
+	if peak > 2 {
+		t.Errorf("Unexpected concurrent downloads, got %d larger than 2", peak)
+	}
+	for _, node := range nodes {
+		if src := node.(telegraph.NodeElement).Attrs["src"]; !strings.HasPrefix(src, "https://example.org/uploaded.png") {
+			t.Errorf("Unexpected src, got %s", src)
+		}
+	}
+}
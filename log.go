@@ -0,0 +1,49 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"github.com/wabarc/logger"
+)
+
+// Logger receives the debug and error messages of an Archiver.
+type Logger interface {
+	Debug(format string, v ...interface{})
+	Error(format string, v ...interface{})
+}
+
+// WithLogger sets the logger of the archiver, defaults to github.com/wabarc/logger
+// which prints debug messages when the DEBUG environment variable is set.
+func WithLogger(l Logger) Option {
+	return func(arc *Archiver) {
+		arc.log = l
+	}
+}
+
+// defaultLogger writes to github.com/wabarc/logger.
+type defaultLogger struct{}
+
+func (defaultLogger) Debug(format string, v ...interface{}) {
+	logger.Debug(format, v...)
+}
+
+func (defaultLogger) Error(format string, v ...interface{}) {
+	logger.Error(format, v...)
+}
+
+func (arc *Archiver) logger() Logger {
+	if arc.log != nil {
+		return arc.log
+	}
+	return defaultLogger{}
+}
+
+// orDefault returns l, or the default logger if l is nil.
+func orDefault(l Logger) Logger {
+	if l != nil {
+		return l
+	}
+	return defaultLogger{}
+}
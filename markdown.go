@@ -0,0 +1,446 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kallydev/telegraph-go"
+	"github.com/pkg/errors"
+)
+
+var (
+	headingRe  = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	ruleRe     = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	listItemRe = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])(?:[ \t]+|$)`)
+	autolinkRe = regexp.MustCompile(`^<((?:https?|ftp|mailto):[^\s<>]+)>`)
+)
+
+// PublishMarkdown publishes the Markdown file at path to telegra.ph, it returns the URLs
+// of the pages. The page is titled by the leading top-level heading of the file, or else
+// the file name. Local images are resolved relative to the file and uploaded.
+func (arc *Archiver) PublishMarkdown(ctx context.Context, path string) ([]string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read markdown failed")
+	}
+
+	title, nodes := ParseMarkdown(src)
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := arc.uploadLocalImages(ctx, nodes, filepath.Dir(path)); err != nil {
+		return nil, newError(ErrUpload, path, err)
+	}
+
+	return arc.Publish(ctx, Document{Title: title, Nodes: nodes})
+}
+
+// uploadLocalImages uploads the images of nodes referring to local files, relative
+// paths are resolved against dir.
+func (arc *Archiver) uploadLocalImages(ctx context.Context, nodes []telegraph.Node, dir string) error {
+	for _, node := range nodes {
+		element, ok := node.(telegraph.NodeElement)
+		if !ok {
+			continue
+		}
+		if err := arc.uploadLocalImages(ctx, element.Children, dir); err != nil {
+			return err
+		}
+		src := element.Attrs["src"]
+		if element.Tag != "img" || src == "" || strings.Contains(src, "://") || strings.HasPrefix(src, "data:") {
+			continue
+		}
+
+		path := src
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, filepath.FromSlash(path))
+		}
+		dst, err := arc.uploadImage(ctx, path)
+		if err != nil {
+			return err
+		}
+		// Map the uploaded image to itself so that it is not transferred again.
+		if err := arc.imageCache().Set(sourceKey(dst), dst); err != nil {
+			arc.logger().Error("[telegraph] cache image failed: %v", err)
+		}
+		element.Attrs["src"] = dst
+	}
+
+	return nil
+}
+
+// ParseMarkdown converts Markdown to Telegraph nodes. Headings, paragraphs, lists, code
+// blocks, blockquotes, horizontal rules, links and images are supported, other inline
+// syntax such as emphasis is kept as text. The text of a leading top-level heading is
+// returned as the title and left out of the nodes.
+func ParseMarkdown(src []byte) (title string, nodes []telegraph.Node) {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	lines := strings.Split(text, "\n")
+
+	// Skip front matter
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "---" {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if m := headingRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil && len(m[1]) == 1 && indentOf(line) < 4 {
+			title = textOf(parseInline(m[2]))
+			lines = lines[i+1:]
+		}
+		break
+	}
+
+	return title, parseBlocks(lines)
+}
+
+func parseBlocks(lines []string) []telegraph.Node {
+	var nodes []telegraph.Node
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			nodes = append(nodes, paragraph(para))
+		}
+		para = nil
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+			i++
+		case len(para) == 0 && indentOf(line) >= 4:
+			var code []string
+			for ; i < len(lines) && (indentOf(lines[i]) >= 4 || strings.TrimSpace(lines[i]) == ""); i++ {
+				code = append(code, dedent(lines[i], 4))
+			}
+			nodes = append(nodes, preformatted(code))
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			fence := trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+			indent := indentOf(line)
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) && strings.Trim(strings.TrimSpace(lines[i]), fence[:1]) == "" {
+					i++
+					break
+				}
+				code = append(code, dedent(lines[i], indent))
+			}
+			nodes = append(nodes, preformatted(code))
+		case headingRe.MatchString(trimmed):
+			flush()
+			m := headingRe.FindStringSubmatch(trimmed)
+			tag := "h3"
+			if len(m[1]) > 2 {
+				tag = "h4"
+			}
+			if children := parseInline(m[2]); len(children) > 0 {
+				nodes = append(nodes, telegraph.NodeElement{Tag: tag, Children: children})
+			}
+			i++
+		case ruleRe.MatchString(trimmed):
+			flush()
+			nodes = append(nodes, telegraph.NodeElement{Tag: "hr"})
+			i++
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				line := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(line, " "))
+			}
+			if children := inlineBlocks(parseBlocks(quote)); len(children) > 0 {
+				nodes = append(nodes, telegraph.NodeElement{Tag: "blockquote", Children: children})
+			}
+		case listItemRe.MatchString(line) && (len(para) == 0 || strings.TrimSpace(listItemRe.ReplaceAllString(line, "")) != ""):
+			flush()
+			var list telegraph.Node
+			list, i = parseList(lines, i)
+			nodes = append(nodes, list)
+		default:
+			para = append(para, line)
+			i++
+		}
+	}
+	flush()
+
+	return nodes
+}
+
+// parseList parses the list starting at lines[i], it returns the list and the index of
+// the line following it.
+func parseList(lines []string, i int) (telegraph.Node, int) {
+	m := listItemRe.FindStringSubmatch(lines[i])
+	indent, ordered := len(m[1]), isOrdered(m[2])
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+
+	// sameList reports whether line is another item of the list.
+	sameList := func(line string) bool {
+		m := listItemRe.FindStringSubmatch(line)
+		return m != nil && len(m[1]) == indent && isOrdered(m[2]) == ordered
+	}
+
+	var items []telegraph.Node
+	for i < len(lines) && sameList(lines[i]) {
+		m := listItemRe.FindStringSubmatch(lines[i])
+		offset := len(m[0])
+		body := []string{lines[i][offset:]}
+		if strings.TrimSpace(body[0]) == "" {
+			offset = len(m[1]) + len(m[2]) + 1
+		}
+
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				j := i
+				for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+					j++
+				}
+				if j < len(lines) && indentOf(lines[j]) > indent && !sameList(lines[j]) {
+					body = append(body, "")
+					continue
+				}
+				if j < len(lines) && sameList(lines[j]) {
+					i = j
+				}
+				break
+			}
+			if sameList(line) || (indentOf(line) <= indent && startsBlock(line)) {
+				break
+			}
+			body = append(body, dedent(line, offset))
+		}
+
+		items = append(items, telegraph.NodeElement{Tag: "li", Children: inlineBlocks(parseBlocks(body))})
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			break
+		}
+	}
+
+	return telegraph.NodeElement{Tag: tag, Children: items}, i
+}
+
+func isOrdered(marker string) bool {
+	return marker != "-" && marker != "*" && marker != "+"
+}
+
+// startsBlock reports whether the line starts a block other than a paragraph.
+func startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return headingRe.MatchString(trimmed) || ruleRe.MatchString(trimmed) || listItemRe.MatchString(line) ||
+		strings.HasPrefix(trimmed, ">") || strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+}
+
+// inlineBlocks replaces paragraphs with their children separated by line breaks,
+// for the list items and blockquotes that may not contain paragraphs.
+func inlineBlocks(nodes []telegraph.Node) []telegraph.Node {
+	var out []telegraph.Node
+	for i, node := range nodes {
+		element, ok := node.(telegraph.NodeElement)
+		if !ok || element.Tag != "p" {
+			out = append(out, node)
+			continue
+		}
+		if i > 0 {
+			out = append(out, telegraph.NodeElement{Tag: "br"})
+		}
+		out = append(out, element.Children...)
+	}
+
+	return out
+}
+
+// paragraph converts the lines to a paragraph, or a figure if the lines consist of
+// an image alone.
+func paragraph(lines []string) telegraph.Node {
+	for i := range lines {
+		lines[i] = strings.TrimLeft(lines[i], " ")
+	}
+	children := parseInline(strings.Join(lines, "\n"))
+	if len(children) == 1 {
+		if img, ok := children[0].(telegraph.NodeElement); ok && img.Tag == "img" {
+			figure := []telegraph.Node{img}
+			if alt := img.Attrs["alt"]; alt != "" {
+				figure = append(figure, telegraph.NodeElement{Tag: "figcaption", Children: []telegraph.Node{alt}})
+			}
+			return telegraph.NodeElement{Tag: "figure", Children: figure}
+		}
+	}
+
+	return telegraph.NodeElement{Tag: "p", Children: children}
+}
+
+func preformatted(lines []string) telegraph.Node {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return telegraph.NodeElement{Tag: "pre", Children: []telegraph.Node{strings.Join(lines, "\n")}}
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// dedent removes up to n leading spaces from the line.
+func dedent(line string, n int) string {
+	if indent := indentOf(line); indent < n {
+		n = indent
+	}
+	return line[n:]
+}
+
+// parseInline converts the inline Markdown of a block to nodes.
+func parseInline(s string) []telegraph.Node {
+	return newInlineParser(s).parse(0, len(s))
+}
+
+// inlineParser parses inline Markdown in linear time, brackets and parentheses are
+// matched in a single pass up front.
+type inlineParser struct {
+	s     string
+	close map[int]int // index of the bracket or parenthesis closing the one at an index
+}
+
+func newInlineParser(s string) *inlineParser {
+	p := &inlineParser{s: s, close: make(map[int]int)}
+
+	var brackets, parens []int
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && escapable(s[i+1]):
+			i++
+		case c == '[':
+			brackets = append(brackets, i)
+		case c == '(':
+			parens = append(parens, i)
+		case c == ']' && len(brackets) > 0:
+			p.close[brackets[len(brackets)-1]] = i
+			brackets = brackets[:len(brackets)-1]
+		case c == ')' && len(parens) > 0:
+			p.close[parens[len(parens)-1]] = i
+			parens = parens[:len(parens)-1]
+		}
+	}
+
+	return p
+}
+
+// parse converts s[lo:hi] to nodes.
+func (p *inlineParser) parse(lo, hi int) []telegraph.Node {
+	s := p.s
+	var nodes []telegraph.Node
+	var text strings.Builder
+	element := func(tag string, attrs map[string]string, children []telegraph.Node) {
+		if text.Len() > 0 {
+			nodes = append(nodes, text.String())
+		}
+		text.Reset()
+		nodes = append(nodes, telegraph.NodeElement{Tag: tag, Attrs: attrs, Children: children})
+	}
+
+	for i := lo; i < hi; {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < hi && s[i+1] == '\n':
+			element("br", nil, nil)
+			i += 2
+		case c == '\\' && i+1 < hi && escapable(s[i+1]):
+			text.WriteByte(s[i+1])
+			i += 2
+		case c == '\n':
+			if t := text.String(); strings.HasSuffix(t, "  ") {
+				text.Reset()
+				text.WriteString(strings.TrimRight(t, " "))
+				element("br", nil, nil)
+			} else {
+				text.WriteByte(' ')
+			}
+			i++
+		case c == '!' && i+1 < hi && s[i+1] == '[':
+			label, dest, end, ok := p.link(i+1, hi)
+			if !ok {
+				text.WriteByte(c)
+				i++
+				break
+			}
+			attrs := map[string]string{"src": dest}
+			if alt := textOf(p.parse(i+2, label)); alt != "" {
+				attrs["alt"] = alt
+			}
+			element("img", attrs, nil)
+			i = end
+		case c == '[':
+			label, dest, end, ok := p.link(i, hi)
+			if !ok {
+				text.WriteByte(c)
+				i++
+				break
+			}
+			element("a", map[string]string{"href": dest}, p.parse(i+1, label))
+			i = end
+		case c == '<' && autolinkRe.MatchString(s[i:hi]):
+			m := autolinkRe.FindStringSubmatch(s[i:hi])
+			element("a", map[string]string{"href": m[1]}, []telegraph.Node{m[1]})
+			i += len(m[0])
+		default:
+			text.WriteByte(c)
+			i++
+		}
+	}
+	if text.Len() > 0 {
+		nodes = append(nodes, text.String())
+	}
+
+	return nodes
+}
+
+// link parses a link starting at the opening bracket at i, it returns the index of
+// the closing bracket, the destination and the index following the link.
+func (p *inlineParser) link(i, hi int) (label int, dest string, end int, ok bool) {
+	s := p.s
+	closing, ok := p.close[i]
+	if !ok || closing+1 >= hi || s[closing+1] != '(' {
+		return 0, "", 0, false
+	}
+	paren, ok := p.close[closing+1]
+	if !ok || paren >= hi {
+		return 0, "", 0, false
+	}
+
+	target := strings.TrimSpace(s[closing+2 : paren])
+	// Drop the link title, e.g. [text](url "title")
+	if k := strings.IndexAny(target, " \n"); k >= 0 {
+		target = target[:k]
+	}
+	target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+	if target == "" {
+		return 0, "", 0, false
+	}
+
+	return closing, target, paren + 1, true
+}
+
+func escapable(c byte) bool {
+	return strings.IndexByte("\\`*_{}[]()#+-.!<>~|", c) >= 0
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		title    string
+		nodes    string
+	}{
+		{
+			name:     "title",
+			markdown: "# Release v1.2\n\nNotes",
+			title:    "Release v1.2",
+			nodes:    `[{"tag":"p","children":["Notes"]}]`,
+		},
+		{
+			name:     "headings",
+			markdown: "Intro\n\n# One\n## Two\n### Three",
+			nodes:    `[{"tag":"p","children":["Intro"]},{"tag":"h3","children":["One"]},{"tag":"h3","children":["Two"]},{"tag":"h4","children":["Three"]}]`,
+		},
+		{
+			name:     "inline",
+			markdown: "Some *em*, `co*de*` and [link](https://example.org \"title\") in snake_case",
+			nodes:    `[{"tag":"p","children":["Some *em*, ` + "`co*de*`" + ` and ",{"tag":"a","attrs":{"href":"https://example.org"},"children":["link"]}," in snake_case"]}]`,
+		},
+		{
+			name:     "escapes and autolinks",
+			markdown: "\\[not](a link) but [[nested]](https://example.org) and <https://example.org/a>",
+			nodes:    `[{"tag":"p","children":["[not](a link) but ",{"tag":"a","attrs":{"href":"https://example.org"},"children":["[nested]"]}," and ",{"tag":"a","attrs":{"href":"https://example.org/a"},"children":["https://example.org/a"]}]}]`,
+		},
+		{
+			name:     "line break",
+			markdown: "first  \nsecond\nthird",
+			nodes:    `[{"tag":"p","children":["first",{"tag":"br"},"second third"]}]`,
+		},
+		{
+			name:     "lists",
+			markdown: "- one\n- two\n  - nested\n\n1. first\n2. second",
+			nodes:    `[{"tag":"ul","children":[{"tag":"li","children":["one"]},{"tag":"li","children":["two",{"tag":"ul","children":[{"tag":"li","children":["nested"]}]}]}]},{"tag":"ol","children":[{"tag":"li","children":["first"]},{"tag":"li","children":["second"]}]}]`,
+		},
+		{
+			name:     "code block",
+			markdown: "```go\nfunc main() {\n\n}\n```\n\n    indented",
+			nodes:    `[{"tag":"pre","children":["func main() {\n\n}"]},{"tag":"pre","children":["indented"]}]`,
+		},
+		{
+			name:     "blockquote and rule",
+			markdown: "> quoted\n> text\n\n---",
+			nodes:    `[{"tag":"blockquote","children":["quoted text"]},{"tag":"hr"}]`,
+		},
+		{
+			name:     "image",
+			markdown: "![diagram](img/a.png)\n\ntext ![](https://example.org/b.png)",
+			nodes:    `[{"tag":"figure","children":[{"tag":"img","attrs":{"alt":"diagram","src":"img/a.png"}},{"tag":"figcaption","children":["diagram"]}]},{"tag":"p","children":["text ",{"tag":"img","attrs":{"src":"https://example.org/b.png"}}]}]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			title, nodes := ParseMarkdown([]byte(test.markdown))
+			if title != test.title {
+				t.Errorf("Unexpected title, got %q instead of %q", title, test.title)
+			}
+			buf, _ := json.Marshal(nodes)
+			if string(buf) != test.nodes {
+				t.Errorf("Unexpected nodes, got %s instead of %s", buf, test.nodes)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownUnclosed(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, s := range []string{"[a](", "![a](", "[[a]("} {
+			ParseMarkdown([]byte(strings.Repeat(s, 1<<16)))
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unexpected parse time of unclosed links")
+	}
+}
+
+// nolint:errcheck
+func TestPublishMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	img := genImage()
+	defer os.Remove(img.Name())
+	data, _ := os.ReadFile(img.Name())
+	os.WriteFile(filepath.Join(dir, "shot.png"), data, 0600)
+	file := filepath.Join(dir, "release.md")
+	os.WriteFile(file, []byte("# Release\n\n![shot](shot.png)\n\n- fixed"), 0600)
+
+	arc, srv := newTestArchiver(t)
+	dsts, err := arc.PublishMarkdown(context.Background(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := srv.Pages()
+	if len(dsts) != 1 || len(pages) != 1 || dsts[0] != pages[0].URL {
+		t.Fatalf("Unexpected pages, got %v", dsts)
+	}
+	if pages[0].Title != "Release" {
+		t.Errorf("Unexpected title, got %s instead of Release", pages[0].Title)
+	}
+	buf, _ := json.Marshal(pages[0].Content)
+	if got := string(buf); !strings.Contains(got, `"src":"`+srv.URL+`/file/`) || !strings.Contains(got, "fixed") {
+		t.Errorf("Unexpected content, got %s", got)
+	}
+	if srv.Files() != 1 {
+		t.Errorf("Unexpected uploads, got %d instead of 1", srv.Files())
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"fmt"
+)
+
+// Mode selects what Wayback publishes of a webpage.
+type Mode string
+
+// Modes of Wayback.
+const (
+	// ModeFull publishes the article with links to the screenshot, or the
+	// screenshot alone if no article is found. It is the default.
+	ModeFull Mode = "screenshot+article"
+
+	// ModeArticle publishes the article only, no browser is required.
+	ModeArticle Mode = "article-only"
+
+	// ModeScreenshot publishes the screenshot only.
+	ModeScreenshot Mode = "screenshot-only"
+)
+
+// ParseMode returns the Mode named by s, either its value or one of the short names
+// "full", "article" and "screenshot".
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case ModeFull, "full", "":
+		return ModeFull, nil
+	case ModeArticle, "article":
+		return ModeArticle, nil
+	case ModeScreenshot, "screenshot":
+		return ModeScreenshot, nil
+	}
+	return "", fmt.Errorf("unknown mode %q", s)
+}
+
+type ctxKeyMode struct{}
+
+// WithMode puts the Mode of Wayback into context.
+func (arc *Archiver) WithMode(ctx context.Context, mode Mode) context.Context {
+	return context.WithValue(ctx, ctxKeyMode{}, mode)
+}
+
+func modeFromContext(ctx context.Context) Mode {
+	if mode, ok := ctx.Value(ctxKeyMode{}).(Mode); ok && mode != "" {
+		return mode
+	}
+	return ModeFull
+}
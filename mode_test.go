@@ -0,0 +1,169 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wabarc/screenshot"
+)
+
+const articleHTML = `<html><head><title>Archiving the Web</title></head><body>
+<article><h1>Archiving the Web</h1>
+<p>Web archiving is the process of collecting portions of the World Wide Web to ensure the information is preserved in an archive for future researchers, historians, and the public.</p>
+<p>Web archivists typically employ web crawlers for automated capture due to the massive size and amount of information on the Web. The largest web archiving organization based on a bulk crawling approach is the Wayback Machine.</p>
+<p>The growing portion of human culture created and recorded on the web makes it inevitable that more and more libraries and archives will have to face the challenges of web archiving.</p>
+</article></body></html>`
+
+func TestWaybackArticleMode(t *testing.T) {
+	ts := httptest.NewServer(writeHTML(articleHTML))
+	defer ts.Close()
+
+	arc, srv := newTestArchiver(t)
+	input, _ := url.Parse(ts.URL)
+	ctx := arc.WithMode(context.Background(), ModeArticle)
+	dsts, err := arc.WaybackAll(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := srv.Pages()
+	if len(dsts) != 1 || len(pages) != 1 || dsts[0] != pages[0].URL {
+		t.Fatalf("Unexpected pages, got %v", dsts)
+	}
+	if pages[0].Title != "Archiving the Web" {
+		t.Errorf("Unexpected title, got %s instead of Archiving the Web", pages[0].Title)
+	}
+
+	buf, _ := json.Marshal(pages[0].Content)
+	got := string(buf)
+	if !strings.Contains(got, "Wayback Machine") {
+		t.Errorf("Unexpected content, article not found in %s", got)
+	}
+	if strings.Contains(got, "screenshots") || strings.Contains(got, `"img"`) {
+		t.Errorf("Unexpected content, screenshot found in %s", got)
+	}
+	if srv.Files() != 0 {
+		t.Errorf("Unexpected uploads, got %d instead of 0", srv.Files())
+	}
+}
+
+func TestWaybackArticleModeNoArticle(t *testing.T) {
+	ts := httptest.NewServer(writeHTML(`<html><body></body></html>`))
+	defer ts.Close()
+
+	arc := New()
+	arc.client = newAPI(nil, "token", testRetryPolicy, nil)
+
+	input, _ := url.Parse(ts.URL)
+	ctx := arc.WithMode(context.Background(), ModeArticle)
+	if _, err := arc.WaybackAll(ctx, input); !errors.Is(err, ErrReadability) {
+		t.Errorf("Unexpected error, got %v instead of %v", err, ErrReadability)
+	}
+}
+
+func TestWaybackScreenshotMode(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		writeHTML(articleHTML).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	img := genImage()
+	defer os.Remove(img.Name())
+
+	arc, srv := newTestArchiver(t)
+	input, _ := url.Parse(ts.URL)
+	ctx := arc.WithMode(context.Background(), ModeScreenshot)
+	ctx = arc.WithShot(ctx, &screenshot.Screenshots[screenshot.Path]{
+		URL:   ts.URL,
+		Title: "Archiving the Web",
+		Image: screenshot.Path(img.Name()),
+	})
+	res, err := arc.Archive(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := srv.Pages()
+	if len(res.URLs) != 1 || len(pages) != 1 {
+		t.Fatalf("Unexpected pages, got %v", res.URLs)
+	}
+
+	buf, _ := json.Marshal(pages[0].Content)
+	if got := string(buf); !strings.Contains(got, `"img"`) || strings.Contains(got, "Wayback Machine") {
+		t.Errorf("Unexpected content, got %s", got)
+	}
+	if requests != 0 {
+		t.Errorf("Unexpected requests to the webpage, got %d instead of 0", requests)
+	}
+	for _, stage := range []string{StageCapture, StageReadability} {
+		if _, ok := res.Timings[stage]; ok {
+			t.Errorf("Unexpected timings, %s found in screenshot mode", stage)
+		}
+	}
+}
+
+func TestWaybackScreenshotModeUntitled(t *testing.T) {
+	img := genImage()
+	defer os.Remove(img.Name())
+
+	arc, srv := newTestArchiver(t)
+	input, _ := url.Parse("https://example.org/")
+	ctx := arc.WithMode(context.Background(), ModeScreenshot)
+	ctx = arc.WithShot(ctx, &screenshot.Screenshots[screenshot.Path]{
+		URL:   input.String(),
+		Image: screenshot.Path(img.Name()),
+	})
+	if _, err := arc.WaybackAll(ctx, input); err != nil {
+		t.Fatal(err)
+	}
+	if pages := srv.Pages(); len(pages) != 1 || pages[0].Title != "Missing Title" {
+		t.Errorf("Unexpected pages, got %+v", pages)
+	}
+}
+
+func TestModeFromContext(t *testing.T) {
+	arc := New()
+	if mode := modeFromContext(context.Background()); mode != ModeFull {
+		t.Errorf("Unexpected default mode, got %s instead of %s", mode, ModeFull)
+	}
+	if mode := modeFromContext(arc.WithMode(context.Background(), ModeScreenshot)); mode != ModeScreenshot {
+		t.Errorf("Unexpected mode, got %s instead of %s", mode, ModeScreenshot)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name string
+		mode Mode
+	}{
+		{"", ModeFull},
+		{"full", ModeFull},
+		{"screenshot+article", ModeFull},
+		{"article", ModeArticle},
+		{"article-only", ModeArticle},
+		{"screenshot", ModeScreenshot},
+		{"screenshot-only", ModeScreenshot},
+	}
+	for _, test := range tests {
+		mode, err := ParseMode(test.name)
+		if err != nil || mode != test.mode {
+			t.Errorf("Unexpected mode of %q, got %s (%v) instead of %s", test.name, mode, err, test.mode)
+		}
+	}
+
+	if _, err := ParseMode("pdf"); err == nil {
+		t.Errorf("Unexpected mode of pdf")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/kallydev/telegraph-go"
+	"github.com/pkg/errors"
+)
+
+// pageListLimit is the most pages getPageList returns at once.
+const pageListLimit = 200
+
+// Pages returns all pages of the account of the archiver, most recent first. No account
+// is created, ErrNoAccount is returned if none is set on the archiver or stored.
+func (arc *Archiver) Pages(ctx context.Context) ([]telegraph.Page, error) {
+	client, err := arc.dialExisting(ctx)
+	if err != nil {
+		return nil, newError(ErrAccount, "", err)
+	}
+
+	var pages []telegraph.Page
+	for {
+		list, err := client.getPageList(ctx, len(pages), pageListLimit)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, list.Pages...)
+		if len(list.Pages) == 0 || len(pages) >= list.TotalCount {
+			return pages, nil
+		}
+	}
+}
+
+// Page returns the page with its content, page is the path or the URL of the page.
+func (arc *Archiver) Page(ctx context.Context, page string) (*telegraph.Page, error) {
+	client := arc.anonymous()
+
+	p, err := client.getPage(ctx, pagePath(page), true)
+	if err != nil {
+		return nil, err
+	}
+	p.Content = decodeNodes(p.Content)
+
+	return p, nil
+}
+
+// Views returns the number of views of the page, in total if period is empty, or else
+// within the year "2006", the month "2006-01", the day "2006-01-02" or the hour
+// "2006-01-02T15" given by period. Page is the path or the URL of the page.
+func (arc *Archiver) Views(ctx context.Context, page, period string) (int, error) {
+	client := arc.anonymous()
+
+	params := map[string]string{}
+	if period != "" {
+		layouts := []struct {
+			layout string
+			fields []string
+		}{
+			{"2006", []string{"year"}},
+			{"2006-01", []string{"year", "month"}},
+			{"2006-01-02", []string{"year", "month", "day"}},
+			{"2006-01-02T15", []string{"year", "month", "day", "hour"}},
+		}
+		var parsed bool
+		for _, l := range layouts {
+			t, err := time.Parse(l.layout, period)
+			if err != nil {
+				continue
+			}
+			values := []int{t.Year(), int(t.Month()), t.Day(), t.Hour()}
+			for i, field := range l.fields {
+				params[field] = strconv.Itoa(values[i])
+			}
+			parsed = true
+			break
+		}
+		if !parsed {
+			return 0, errors.Errorf("invalid period %q", period)
+		}
+	}
+
+	return client.getViews(ctx, pagePath(page), params)
+}
+
+// decodeNodes converts nodes decoded from JSON, where elements are maps, to
+// telegraph.NodeElement.
+func decodeNodes(nodes []telegraph.Node) []telegraph.Node {
+	out := make([]telegraph.Node, 0, len(nodes))
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case string, telegraph.NodeElement:
+			out = append(out, n)
+		case map[string]interface{}:
+			element := telegraph.NodeElement{}
+			element.Tag, _ = n["tag"].(string)
+			if attrs, ok := n["attrs"].(map[string]interface{}); ok {
+				element.Attrs = make(map[string]string, len(attrs))
+				for k, v := range attrs {
+					element.Attrs[k], _ = v.(string)
+				}
+			}
+			if children, ok := n["children"].([]interface{}); ok {
+				nodes := make([]telegraph.Node, len(children))
+				for i, child := range children {
+					nodes[i] = child
+				}
+				element.Children = decodeNodes(nodes)
+			}
+			out = append(out, element)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kallydev/telegraph-go"
+	"github.com/wabarc/telegra.ph/phtest"
+)
+
+// newTestPages returns an Archiver with n pages created on a fake Telegraph server.
+func newTestPages(t *testing.T, n int) (*Archiver, *phtest.Server) {
+	arc, srv := newTestArchiver(t)
+	client, err := arc.dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []telegraph.Node{"text", telegraph.NodeElement{
+		Tag:      "p",
+		Attrs:    map[string]string{"class": "x"},
+		Children: []telegraph.Node{telegraph.NodeElement{Tag: "b", Children: []telegraph.Node{"bold"}}},
+	}}
+	for i := 0; i < n; i++ {
+		if _, err := client.createPage(context.Background(), fmt.Sprintf("Page %d", i), content, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return arc, srv
+}
+
+func TestPages(t *testing.T) {
+	arc, srv := newTestPages(t, 250)
+
+	pages, err := arc.Pages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := srv.Pages()
+	if len(pages) != 250 || len(created) != 250 {
+		t.Fatalf("Unexpected pages, got %d instead of 250", len(pages))
+	}
+	// Most recent first
+	if pages[0].Path != created[249].Path || pages[249].Path != created[0].Path {
+		t.Errorf("Unexpected order, got %s first instead of %s", pages[0].Path, created[249].Path)
+	}
+}
+
+func TestPagesNoAccount(t *testing.T) {
+	arc, srv := newTestArchiver(t)
+
+	if _, err := arc.Pages(context.Background()); !errors.Is(err, ErrNoAccount) || !errors.Is(err, ErrAccount) {
+		t.Errorf("Unexpected error, got %v instead of %v", err, ErrNoAccount)
+	}
+	if calls := srv.Calls("createAccount"); calls != 0 {
+		t.Errorf("Unexpected calls of createAccount, got %d instead of 0", calls)
+	}
+}
+
+func TestPage(t *testing.T) {
+	_, srv := newTestPages(t, 1)
+	created := srv.Pages()[0]
+
+	// Pages are read without an account.
+	arc := New(WithBaseURL(srv.URL), WithRetryPolicy(testRetryPolicy))
+	page, err := arc.Page(context.Background(), created.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Path != created.Path || len(page.Content) != 2 {
+		t.Fatalf("Unexpected page, got %#v", page)
+	}
+	p, ok := page.Content[1].(telegraph.NodeElement)
+	if !ok || p.Tag != "p" || p.Attrs["class"] != "x" {
+		t.Fatalf("Unexpected element, got %#v", page.Content[1])
+	}
+	if b, ok := p.Children[0].(telegraph.NodeElement); !ok || b.Tag != "b" || b.Children[0] != "bold" {
+		t.Errorf("Unexpected child, got %#v", p.Children[0])
+	}
+	if calls := srv.Calls("createAccount"); calls != 1 {
+		t.Errorf("Unexpected calls of createAccount, got %d instead of 1 creating the pages", calls)
+	}
+}
+
+func TestViews(t *testing.T) {
+	_, srv := newTestPages(t, 1)
+	created := srv.Pages()[0]
+	arc := New(WithBaseURL(srv.URL), WithRetryPolicy(testRetryPolicy))
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(created.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	for _, period := range []string{"", "2021", "2021-01", "2021-01-02", "2021-01-02T15"} {
+		views, err := arc.Views(context.Background(), created.Path, period)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if views != 3 {
+			t.Errorf("Unexpected views of period %q, got %d instead of 3", period, views)
+		}
+	}
+
+	if _, err := arc.Views(context.Background(), created.Path, "yesterday"); err == nil {
+		t.Errorf("Unexpected views of invalid period")
+	}
+	if calls := srv.Calls("createAccount"); calls != 1 {
+		t.Errorf("Unexpected calls of createAccount, got %d instead of 1 creating the pages", calls)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+const (
+	// Telegraph rejects page content larger than 64 KB.
+	maxContentSize = 64 * 1024
+
+	// navReserve is the room left in every part for the navigation
+	// links, the first part also leaves room for the table of contents.
+	navReserve = 4 * 1024
+
+	maxTitleLength = 256
+)
+
+// nodeSize returns the size of the node serialized as Telegraph content.
+func nodeSize(node telegraph.Node) int {
+	buf, err := json.Marshal(node)
+	if err != nil {
+		return 0
+	}
+	return len(buf)
+}
+
+// paginate splits nodes into parts whose serialized size fits limit. Nodes are split
+// on block boundaries, a node larger than limit is split over its children.
+func paginate(nodes []telegraph.Node, limit int) [][]telegraph.Node {
+	var parts [][]telegraph.Node
+	var part []telegraph.Node
+	// Size of the empty JSON array
+	size := 2
+
+	flush := func() {
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+		part, size = nil, 2
+	}
+
+	for _, node := range nodes {
+		n := nodeSize(node) + 1
+		if n > limit {
+			flush()
+			for _, piece := range splitNode(node, limit-2) {
+				parts = append(parts, []telegraph.Node{piece})
+			}
+			continue
+		}
+		if size+n > limit {
+			flush()
+		}
+		part = append(part, node)
+		size += n
+	}
+	flush()
+
+	return parts
+}
+
+// paginateTOC paginates nodes like paginate, leaving room in the first part for the
+// table of contents of the parts titled after title. The first part is shrunk until
+// the table fits, though never below a quarter of limit.
+func paginateTOC(nodes []telegraph.Node, limit int, title []rune) [][]telegraph.Node {
+	parts := paginate(nodes, limit)
+	for total := len(parts); total > 1; total = len(parts) {
+		first := limit - total*tocEntrySize(title, total)
+		if first < limit/4 {
+			first = limit / 4
+		}
+		head := paginate(nodes, first)
+		var rest []telegraph.Node
+		for _, part := range head[1:] {
+			rest = append(rest, part...)
+		}
+		parts = append(head[:1], paginate(rest, limit)...)
+		// Shrinking the first part may add parts and so entries.
+		if len(parts) <= total {
+			break
+		}
+	}
+
+	return parts
+}
+
+// tocEntrySize returns the size an entry of the table of contents takes at most, for
+// parts titled after title.
+func tocEntrySize(title []rune, total int) int {
+	path := url.PathEscape(partTitle(title, total-1, total)) + "-12-31-999"
+	page := &telegraph.Page{URL: "https://telegra.ph/" + path}
+	return nodeSize(tocEntry(page, total-1, total)) + 1
+}
+
+// splitNode splits a node into several nodes each serialized no larger than limit,
+// elements are copied with a subset of their children.
+func splitNode(node telegraph.Node, limit int) []telegraph.Node {
+	if nodeSize(node) <= limit {
+		return []telegraph.Node{node}
+	}
+
+	switch n := node.(type) {
+	case string:
+		return splitText(n, limit)
+	case telegraph.NodeElement:
+		shell := telegraph.NodeElement{Tag: n.Tag, Attrs: n.Attrs}
+		// Room left for children inside the element
+		room := limit - nodeSize(shell) - len(`,"children":[]`)
+		if room <= 0 || len(n.Children) == 0 {
+			return []telegraph.Node{node}
+		}
+
+		var pieces []telegraph.Node
+		var children []telegraph.Node
+		size := 0
+		flush := func() {
+			if len(children) > 0 {
+				pieces = append(pieces, telegraph.NodeElement{Tag: n.Tag, Attrs: n.Attrs, Children: children})
+			}
+			children, size = nil, 0
+		}
+		for _, child := range n.Children {
+			for _, c := range splitNode(child, room) {
+				cs := nodeSize(c) + 1
+				if size+cs > room {
+					flush()
+				}
+				children = append(children, c)
+				size += cs
+			}
+		}
+		flush()
+
+		return pieces
+	}
+
+	return []telegraph.Node{node}
+}
+
+// splitText splits s into strings each serialized no larger than limit.
+func splitText(s string, limit int) []telegraph.Node {
+	var pieces []telegraph.Node
+	for s != "" {
+		if nodeSize(s) <= limit {
+			pieces = append(pieces, s)
+			break
+		}
+		// Serialized text may grow by escaping, shrink until it fits.
+		end := len(s)
+		if end > limit {
+			end = limit
+		}
+		for end > 0 {
+			for end < len(s) && end > 0 && !utf8.RuneStart(s[end]) {
+				end--
+			}
+			over := nodeSize(s[:end]) - limit
+			if over <= 0 {
+				break
+			}
+			end -= over
+		}
+		if end <= 0 {
+			end = len(s)
+		}
+		pieces = append(pieces, s[:end])
+		s = s[end:]
+	}
+
+	return pieces
+}
+
+// partTitle returns the title of part i of total, truncated to the Telegraph title limit.
+func partTitle(title []rune, i, total int) string {
+	if total <= 1 {
+		if len(title) > maxTitleLength {
+			title = title[:maxTitleLength-1]
+		}
+		return string(title)
+	}
+
+	suffix := []rune(fmt.Sprintf(" (Part %d/%d)", i+1, total))
+	if len(title)+len(suffix) > maxTitleLength {
+		title = title[:maxTitleLength-1-len(suffix)]
+	}
+
+	return string(title) + string(suffix)
+}
+
+// tocEntry returns the entry of the table of contents linking the page of part i.
+func tocEntry(page *telegraph.Page, i, total int) telegraph.Node {
+	return telegraph.NodeElement{
+		Tag: "li",
+		Children: []telegraph.Node{telegraph.NodeElement{
+			Tag:      "a",
+			Attrs:    map[string]string{"href": page.URL},
+			Children: []telegraph.Node{fmt.Sprintf("Part %d/%d", i+1, total)},
+		}},
+	}
+}
+
+// navigate returns the content of part i with the links to its neighbour parts,
+// the first part is prefixed with a table of contents.
+func navigate(parts [][]telegraph.Node, pages []*telegraph.Page, i int) []telegraph.Node {
+	total := len(parts)
+	if total <= 1 {
+		return parts[i]
+	}
+
+	link := func(page *telegraph.Page, text string) telegraph.Node {
+		return telegraph.NodeElement{
+			Tag:      "a",
+			Attrs:    map[string]string{"href": page.URL},
+			Children: []telegraph.Node{text},
+		}
+	}
+
+	var content []telegraph.Node
+	if i == 0 {
+		items := make([]telegraph.Node, 0, total)
+		for j, page := range pages {
+			items = append(items, tocEntry(page, j, total))
+		}
+		content = append(content, telegraph.NodeElement{Tag: "ol", Children: items}, telegraph.NodeElement{Tag: "hr"})
+	}
+	content = append(content, parts[i]...)
+
+	nav := []telegraph.Node{}
+	if i > 0 {
+		nav = append(nav, link(pages[i-1], "« Previous"), " ")
+	}
+	nav = append(nav, fmt.Sprintf("Part %d/%d", i+1, total))
+	if i < total-1 {
+		nav = append(nav, " ", link(pages[i+1], "Next »"))
+	}
+	content = append(content, telegraph.NodeElement{Tag: "hr"}, telegraph.NodeElement{Tag: "p", Children: nav})
+
+	return content
+}
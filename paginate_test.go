@@ -0,0 +1,98 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+func TestPaginate(t *testing.T) {
+	limit := 1024
+	paragraph := func(n int) telegraph.Node {
+		return telegraph.NodeElement{Tag: "p", Children: []telegraph.Node{strings.Repeat("x", n)}}
+	}
+
+	tests := []struct {
+		name  string
+		nodes []telegraph.Node
+		parts int
+	}{
+		{"small", []telegraph.Node{paragraph(10), paragraph(10)}, 1},
+		{"blocks", []telegraph.Node{paragraph(600), paragraph(600), paragraph(600)}, 3},
+		{"nested", []telegraph.Node{telegraph.NodeElement{Tag: "p", Children: []telegraph.Node{paragraph(600), paragraph(600)}}}, 2},
+		{"text", []telegraph.Node{strings.Repeat("文", 1000)}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parts := paginate(test.nodes, limit)
+			if len(parts) != test.parts {
+				t.Fatalf("Unexpected parts, got %d instead of %d", len(parts), test.parts)
+			}
+			for _, part := range parts {
+				if size := nodeSize(part); size > limit {
+					t.Errorf("Unexpected part size, got %d larger than %d", size, limit)
+				}
+			}
+		})
+	}
+}
+
+func TestPaginateTOC(t *testing.T) {
+	var nodes []telegraph.Node
+	for i := 0; i < 6000; i++ {
+		nodes = append(nodes, telegraph.NodeElement{Tag: "p", Children: []telegraph.Node{strings.Repeat("x", 1000)}})
+	}
+	title := []rune("Archiving the Web")
+
+	parts := paginateTOC(nodes, maxContentSize-navReserve, title)
+	if len(parts) < 100 {
+		t.Fatalf("Unexpected parts, got %d instead of at least 100", len(parts))
+	}
+	pages := make([]*telegraph.Page, len(parts))
+	count := 0
+	for i, part := range parts {
+		pages[i] = &telegraph.Page{URL: "https://telegra.ph/" + strings.ReplaceAll(partTitle(title, i, len(parts)), " ", "-") + "-10-17"}
+		count += len(part)
+	}
+	if count != len(nodes) {
+		t.Errorf("Unexpected nodes, got %d instead of %d", count, len(nodes))
+	}
+	for i := range parts {
+		if size := nodeSize(navigate(parts, pages, i)); size > maxContentSize {
+			t.Errorf("Unexpected size of part %d, got %d larger than %d", i+1, size, maxContentSize)
+		}
+	}
+}
+
+func TestPartTitle(t *testing.T) {
+	if title := partTitle([]rune("title"), 0, 1); title != "title" {
+		t.Errorf("Unexpected title, got %s instead of title", title)
+	}
+	if title := partTitle([]rune("title"), 1, 3); title != "title (Part 2/3)" {
+		t.Errorf("Unexpected title, got %s instead of title (Part 2/3)", title)
+	}
+	if title := partTitle([]rune(strings.Repeat("t", 300)), 1, 3); len([]rune(title)) >= maxTitleLength {
+		t.Errorf("Unexpected title length, got %d", len([]rune(title)))
+	}
+}
+
+func TestNavigate(t *testing.T) {
+	parts := [][]telegraph.Node{{"a"}, {"b"}, {"c"}}
+	pages := []*telegraph.Page{{URL: "https://telegra.ph/1"}, {URL: "https://telegra.ph/2"}, {URL: "https://telegra.ph/3"}}
+
+	first := navigate(parts, pages, 0)
+	if toc, ok := first[0].(telegraph.NodeElement); !ok || toc.Tag != "ol" || len(toc.Children) != 3 {
+		t.Errorf("Unexpected table of contents, got %#v", first[0])
+	}
+	middle := navigate(parts, pages, 1)
+	nav := middle[len(middle)-1].(telegraph.NodeElement)
+	if len(nav.Children) != 5 {
+		t.Errorf("Unexpected navigation, got %#v", nav)
+	}
+}
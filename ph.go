@@ -5,12 +5,12 @@
 package ph
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"image"
+	"image/jpeg"
 	"image/png"
-	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -21,7 +21,6 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/cenkalti/backoff/v4"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/go-shiori/go-readability"
 	"github.com/go-shiori/obelisk"
@@ -29,10 +28,10 @@ import (
 	"github.com/oliamb/cutter"
 	"github.com/pkg/errors"
 	"github.com/wabarc/helper"
-	"github.com/wabarc/imgbb"
 	"github.com/wabarc/logger"
 	"github.com/wabarc/screenshot"
 	"golang.org/x/net/html"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -40,24 +39,156 @@ const (
 	maxRetries     = 10
 	perm           = 0644
 	timeout        = 30 * time.Second
+
+	// Telegraph image height limit upper 8976 px
+	defaultTileHeight = 8000
+	jpegQuality       = 90
+)
+
+// ImageFormat is the encoding of screenshot tiles.
+type ImageFormat string
+
+// Supported screenshot tile encodings.
+const (
+	PNG  ImageFormat = "png"
+	JPEG ImageFormat = "jpeg"
 )
 
+func (f ImageFormat) ext() string {
+	if f == JPEG {
+		return "jpg"
+	}
+	return "png"
+}
+
 type subject struct {
 	title  []rune
 	source string
+	author Author
+
+	// page is the existing page overwritten by the first part.
+	page *telegraph.Page
 }
 
 type Archiver struct {
 	sync.RWMutex
 
-	Author string
+	Author Author
 
 	Client *http.Client
 
-	// TODO: add http.Client to upstream
-	client *telegraph.Client
+	client *api
+
+	// baseURL and uploadURL are the endpoints of the Telegraph API and image
+	// uploads, tgClient is the HTTP client for both.
+	baseURL   string
+	uploadURL string
+	tgClient  *http.Client
+
+	// account is the Telegraph account pages are published with,
+	// store persists it across runs.
+	account *telegraph.Account
+	store   AccountStore
 
 	browserRemoteAddr string
+
+	// tileHeight and tileFormat are the height limit and encoding
+	// of screenshot tiles.
+	tileHeight int
+	tileFormat ImageFormat
+
+	// uploaders are the image hosts tried in order.
+	uploaders []ImageUploader
+
+	// retry is the retry policy of network calls.
+	retry *RetryPolicy
+
+	// concurrency and hostConcurrency bound image transfers in total
+	// and per origin server.
+	concurrency     int
+	hostConcurrency int
+	limiterOnce     sync.Once
+	limits          *limiter
+
+	// cache maps transferred images to uploaded URLs, flight
+	// deduplicates transfers in progress.
+	cache     ImageCache
+	cacheOnce sync.Once
+	flight    singleflight.Group
+
+	// timeout bounds the requests of the default HTTP client.
+	timeout time.Duration
+
+	// tempDir holds the screenshots, tiles and images in transfer.
+	tempDir string
+
+	log Logger
+}
+
+// Option configures an Archiver.
+type Option func(*Archiver)
+
+// WithAccessToken sets the access token of an existing Telegraph account,
+// pages will be published with that account instead of a new one.
+func WithAccessToken(token string) Option {
+	return func(arc *Archiver) {
+		if token != "" {
+			arc.account = &telegraph.Account{AccessToken: token}
+		}
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for Telegraph calls, image transfers and
+// webpage capture.
+func WithHTTPClient(client *http.Client) Option {
+	return func(arc *Archiver) {
+		arc.Client = client
+	}
+}
+
+// WithBrowserRemote sets the address of a remote browser to take screenshots with,
+// the local browser is used if it is unreachable.
+func WithBrowserRemote(addr string) Option {
+	return func(arc *Archiver) {
+		arc.browserRemoteAddr = addr
+	}
+}
+
+// WithTimeout sets the request timeout of the default HTTP client, it has no effect
+// together with WithHTTPClient.
+func WithTimeout(d time.Duration) Option {
+	return func(arc *Archiver) {
+		arc.timeout = d
+	}
+}
+
+// WithTempDir sets the directory temporary files are written to, defaults to os.TempDir.
+func WithTempDir(dir string) Option {
+	return func(arc *Archiver) {
+		arc.tempDir = dir
+	}
+}
+
+// WithTileHeight sets the height limit screenshots are sliced to before uploading.
+func WithTileHeight(height int) Option {
+	return func(arc *Archiver) {
+		arc.tileHeight = height
+	}
+}
+
+// WithTileFormat sets the encoding of screenshot tiles, defaults to PNG.
+func WithTileFormat(format ImageFormat) Option {
+	return func(arc *Archiver) {
+		arc.tileFormat = format
+	}
+}
+
+// WithAccountStore sets the store the Telegraph account is loaded from, and saved to
+// when a new account has to be created.
+func WithAccountStore(store AccountStore) Option {
+	return func(arc *Archiver) {
+		arc.store = store
+	}
 }
 
 func init() {
@@ -67,18 +198,35 @@ func init() {
 	}
 }
 
-// New returns a Archiver struct.
-func New(client *http.Client) *Archiver {
-	if client == nil {
-		client = &http.Client{Timeout: timeout}
+// New returns a Archiver struct configured by opts.
+func New(opts ...Option) *Archiver {
+	arc := &Archiver{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(arc)
+		}
+	}
+	if arc.Client == nil {
+		if arc.timeout <= 0 {
+			arc.timeout = timeout
+		}
+		arc.Client = &http.Client{Timeout: arc.timeout}
 	}
 
-	return &Archiver{Client: client}
+	return arc
 }
 
-// SetAuthor return an Archiver struct with Author
+func (arc *Archiver) tmpdir() string {
+	if arc.tempDir != "" {
+		return arc.tempDir
+	}
+	return os.TempDir()
+}
+
+// SetAuthor return an Archiver struct with the given author name,
+// it is equivalent to the Name of WithAuthor.
 func (arc *Archiver) SetAuthor(author string) *Archiver {
-	arc.Author = author
+	arc.Author.Name = author
 	return arc
 }
 
@@ -110,112 +258,177 @@ func articleFromContext(ctx context.Context) readability.Article {
 	return readability.Article{}
 }
 
-// Wayback is the handle of saving webpages to telegra.ph
-func (arc *Archiver) Wayback(ctx context.Context, input *url.URL) (dst string, err error) {
-	client, err := arc.newClient()
+// Wayback is the handle of saving webpages to telegra.ph, it returns the URL of
+// the first page if the content is published over several pages.
+func (arc *Archiver) Wayback(ctx context.Context, input *url.URL) (string, error) {
+	dsts, err := arc.WaybackAll(ctx, input)
 	if err != nil {
-		return "", errors.Wrap(err, `dial client failed`)
+		return "", err
 	}
-	arc.client = client
 
-	dirname, err := os.MkdirTemp(os.TempDir(), "telegraph")
+	return dsts[0], nil
+}
+
+// WaybackAll saves webpages to telegra.ph like Wayback, it returns the URLs of all
+// pages when content too large for a single page is split into linked parts.
+func (arc *Archiver) WaybackAll(ctx context.Context, input *url.URL) ([]string, error) {
+	res, err := arc.Archive(ctx, input)
 	if err != nil {
-		return dst, err
+		return nil, err
 	}
-	defer os.RemoveAll(dirname)
 
+	return res.URLs, nil
+}
+
+// document captures the webpage as selected by the mode in context, files are
+// written to dirname.
+func (arc *Archiver) document(ctx context.Context, input *url.URL, dirname string) (doc Document, err error) {
+	mode := modeFromContext(ctx)
 	shot := shotFromContext(ctx)
-	if shot.HTML == "" || !helper.Exists(fmt.Sprint(shot.HTML)) {
-		file := screenshot.Files{
-			HTML:  filepath.Join(dirname, "telegraph.html"),
-			Image: filepath.Join(dirname, "telegraph.png"),
-		}
-		opts := []screenshot.ScreenshotOption{
-			screenshot.AppendToFile(file),
-			screenshot.ScaleFactor(1),
-			screenshot.RawHTML(true),
-			screenshot.Quality(100),
-		}
-
-		fallback := func() (*screenshot.Screenshots[screenshot.Path], error) {
-			logger.Debug("reduxer using local browser")
-			shot, err := screenshot.Screenshot[screenshot.Path](ctx, input, opts...)
-			if err != nil {
-				if err == context.DeadlineExceeded {
-					return shot, errors.Wrap(err, `screenshot deadline`)
-				}
-				return shot, errors.Wrap(err, `screenshot error`)
-			}
-			return shot, err
-		}
-		if arc.browserRemoteAddr != "" {
-			logger.Debug("reduxer using remote browser")
-			remote, er := screenshot.NewChromeRemoteScreenshoter[screenshot.Path](arc.browserRemoteAddr)
-			if er != nil {
-				shot, err = fallback()
-				goto next
-			}
-			shot, err = remote.Screenshot(ctx, input, opts...)
-			if err != nil {
-				shot, err = fallback()
-			}
-		} else {
-			shot, err = fallback()
+	res := resultFromContext(ctx)
+	// A screenshot alone needs no webpage, the screenshot in context is enough.
+	taken := shot.HTML
+	if mode == ModeScreenshot {
+		taken = shot.Image
+	}
+	if mode != ModeArticle && (taken == "" || !helper.Exists(fmt.Sprint(taken))) {
+		done := res.track(StageScreenshot)
+		shot, err = arc.screenshot(ctx, input, dirname)
+		done()
+		if err != nil {
+			return doc, newError(ErrScreenshot, input.String(), err)
 		}
 	}
-
-next:
-	if err != nil {
-		return "", errors.Wrap(err, "screenshot failed")
+	if err := ctx.Err(); err != nil {
+		return doc, newError(ErrScreenshot, input.String(), err)
+	}
+	if mode == ModeArticle {
+		// Any screenshot in context is left out as well.
+		cp := *shot
+		shot = &cp
+		shot.Image = ""
+		if shot.URL == "" {
+			shot.URL = input.String()
+		}
 	}
 
-	if shot.HTML == "" {
+	if mode != ModeScreenshot && (shot.HTML == "" || !helper.Exists(fmt.Sprint(shot.HTML))) {
+		done := res.track(StageCapture)
 		buf, err := arc.capture(ctx, input)
+		done()
 		if err != nil {
-			return "", errors.Wrap(err, `capture webpage via obelisk failed`)
+			return doc, newError(ErrCapture, input.String(), err)
 		}
 		fp := filepath.Join(dirname, "telegraph.html")
 		shot.HTML = screenshot.Path(fp)
-		os.WriteFile(fp, buf, perm)
+		if err := os.WriteFile(fp, buf, perm); err != nil {
+			return doc, newError(ErrCapture, input.String(), errors.Wrap(err, `write webpage failed`))
+		}
 	}
 
-	if shot.URL == "" || shot.Image == "" {
-		return "", errors.New("data empty")
+	if shot.URL == "" || (mode != ModeArticle && shot.Image == "") {
+		return doc, newError(ErrScreenshot, input.String(), errors.New("data empty"))
 	}
 
-	file, err := os.Open(fmt.Sprint(shot.HTML))
-	if err != nil {
-		return "", errors.Wrap(err, "open failed")
+	var article readability.Article
+	if mode != ModeScreenshot {
+		article = articleFromContext(ctx)
+	}
+	if article.Content == "" && mode != ModeScreenshot {
+		done := res.track(StageReadability)
+		article, err = arc.extract(fmt.Sprint(shot.HTML), input)
+		done()
+		if err != nil && mode == ModeArticle {
+			return doc, newError(ErrReadability, input.String(), err)
+		}
+		if err == nil && strings.TrimSpace(shot.Title) == "" {
+			shot.Title = article.Title
+		}
+	}
+	// Telegraph rejects pages without a title.
+	if strings.TrimSpace(shot.Title) == "" {
+		shot.Title = "Missing Title"
 	}
-	defer file.Close()
 
-	article := articleFromContext(ctx)
-	if article.Content != "" {
-		goto post
+	doc = Document{
+		Title: shot.Title,
+		URL:   shot.URL,
+		HTML:  article.Content,
 	}
+	if shot.Image != "" {
+		doc.Screenshots = []string{fmt.Sprint(shot.Image)}
+	}
+
+	return doc, nil
+}
 
-	article, err = readability.FromReader(file, input)
+// screenshot takes a screenshot of the webpage with the remote browser, or with the
+// local browser if no remote is set or reachable. Files are written to dirname.
+func (arc *Archiver) screenshot(ctx context.Context, input *url.URL, dirname string) (*screenshot.Screenshots[screenshot.Path], error) {
+	file := screenshot.Files{
+		HTML:  filepath.Join(dirname, "telegraph.html"),
+		Image: filepath.Join(dirname, "telegraph.png"),
+	}
+	opts := []screenshot.ScreenshotOption{
+		screenshot.AppendToFile(file),
+		screenshot.ScaleFactor(1),
+		screenshot.RawHTML(true),
+		screenshot.Quality(100),
+	}
+
+	fallback := func() (*screenshot.Screenshots[screenshot.Path], error) {
+		arc.logger().Debug("reduxer using local browser")
+		shot, err := screenshot.Screenshot[screenshot.Path](ctx, input, opts...)
+		if err != nil {
+			if err == context.DeadlineExceeded {
+				return shot, errors.Wrap(err, `screenshot deadline`)
+			}
+			return shot, errors.Wrap(err, `screenshot error`)
+		}
+		return shot, err
+	}
+	if arc.browserRemoteAddr == "" {
+		return fallback()
+	}
+
+	arc.logger().Debug("reduxer using remote browser")
+	remote, err := screenshot.NewChromeRemoteScreenshoter[screenshot.Path](arc.browserRemoteAddr)
 	if err != nil {
-		goto post
+		return fallback()
 	}
-	if strings.TrimSpace(shot.Title) == "" {
-		shot.Title = "Missing Title"
+	shot, err := remote.Screenshot(ctx, input, opts...)
+	if err != nil {
+		return fallback()
 	}
+	return shot, nil
+}
 
-post:
-	sub := subject{title: []rune(shot.Title), source: shot.URL}
-	dst, err = arc.post(sub, article.Content, fmt.Sprint(shot.Image))
+// extract extracts the article from the webpage saved at path.
+func (arc *Archiver) extract(path string, input *url.URL) (readability.Article, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return "", err
+		return readability.Article{}, errors.Wrap(err, "open failed")
 	}
+	defer file.Close()
 
-	return dst, nil
+	article, err := readability.FromReader(file, input)
+	if err != nil {
+		return article, err
+	}
+	if strings.TrimSpace(article.Content) == "" {
+		return article, errors.New("no article found")
+	}
+	return article, nil
 }
 
 func (arc *Archiver) capture(ctx context.Context, uri *url.URL) ([]byte, error) {
+	client := httpClient(arc.Client)
 	req := obelisk.Request{URL: uri.String()}
 	obe := &obelisk.Archiver{
 		SkipResourceURLError: true,
+		RequestTimeout:       client.Timeout,
+		// Obelisk does not bind its requests to the context, do it on the transport.
+		Transport: &ctxTransport{ctx: ctx, base: client.Transport},
 	}
 	obe.Validate()
 
@@ -226,28 +439,48 @@ func (arc *Archiver) capture(ctx context.Context, uri *url.URL) ([]byte, error)
 	return buf, nil
 }
 
-func (arc *Archiver) post(sub subject, content, imgpath string) (dst string, err error) {
-	if len(sub.title) == 0 {
-		return "", fmt.Errorf("Title is required")
-	}
-	if len(sub.title) > 256 {
-		sub.title = sub.title[:255]
+// parseNodes converts the HTML content to Telegraph nodes.
+func (arc *Archiver) parseNodes(content string) []telegraph.Node {
+	arc.logger().Debug("[telegraph] content: %#v", content)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return nil
 	}
+	return castNodes(arc.traverseNodes(doc.Contents()))
+}
 
-	// Telegraph image height limit upper 8976 px
-	// crops, err := splitImage(imgpath, 8000)
-	// if err != nil {
-	// 	return "", err
-	// }
+// post publishes the body with links to the screenshots, or the screenshots alone
+// if there is no body. Screenshots are local image files or URLs of uploaded images.
+func (arc *Archiver) post(ctx context.Context, sub subject, body []telegraph.Node, shots []string) ([]string, error) {
+	if len(sub.title) == 0 {
+		return nil, newError(ErrCreatePage, sub.source, ErrTitleInvalid)
+	}
+	body = blockify(sanitize(body))
+	res := resultFromContext(ctx)
+	done := res.track(StageUpload)
 
-	// paths, err := arc.client.Upload(crops)
-	// if err != nil {
-	// 	return "", err
-	// }
-	paths, _ := arc.uploadImage(imgpath)
+	var paths []string
+	for _, shot := range shots {
+		if strings.HasPrefix(shot, "http://") || strings.HasPrefix(shot, "https://") {
+			paths = append(paths, shot)
+			continue
+		}
+		uploaded, err := arc.uploadScreenshot(ctx, shot)
+		paths = append(paths, uploaded...)
+		res.addImages(uploaded...)
+		if err == nil {
+			continue
+		}
+		// Without the article, the screenshot is the whole page.
+		if len(body) == 0 || ctx.Err() != nil {
+			done()
+			return nil, newError(ErrUpload, sub.source, err)
+		}
+		arc.logger().Error("[telegraph] upload screenshot failed: %v", err)
+	}
 
 	nodes := []telegraph.Node{}
-	if content == "" {
+	if len(body) == 0 {
 		for _, path := range paths {
 			nodes = append(nodes, telegraph.NodeElement{
 				Tag: "img",
@@ -263,7 +496,7 @@ func (arc *Archiver) post(sub subject, content, imgpath string) (dst string, err
 				Children: nodes,
 			},
 		}
-	} else {
+	} else if len(paths) > 0 {
 		nodes = append(nodes, "screenshots: ")
 		for i, path := range paths {
 			nodes = append(nodes, telegraph.NodeElement{
@@ -286,80 +519,265 @@ func (arc *Archiver) post(sub subject, content, imgpath string) (dst string, err
 		}
 	}
 
-	// TODO: improvement for node large than 64 KB
-	logger.Debug("[telegraph] content: %#v", content)
-	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(content)); err == nil {
-		nodes = append(nodes, telegraph.NodeElement{
-			Tag:      "p",
-			Children: castNodes(arc.traverseNodes(doc.Contents())),
-		})
+	if sub.author.Brand && sub.source != "" {
+		nodes = append([]telegraph.Node{
+			telegraph.NodeElement{
+				Tag: "p",
+				Children: []telegraph.Node{
+					"source: ",
+					telegraph.NodeElement{
+						Tag:      "a",
+						Attrs:    map[string]string{"href": sub.source},
+						Children: []telegraph.Node{sub.source},
+					},
+				},
+			},
+		}, nodes...)
+	}
+
+	nodes = append(nodes, arc.transferImages(ctx, body)...)
+	done()
+	if err := ctx.Err(); err != nil {
+		return nil, newError(ErrUpload, sub.source, err)
 	}
 
-	var pat bool
-	var page *telegraph.Page
-	var title = string(sub.title)
-	if page, err = arc.client.CreatePage(title, nodes, nil); err != nil {
-		// Create page with random path if title illegal previous
-		if page, err = arc.client.CreatePage(helper.RandString(6, ""), nodes, nil); err != nil {
-			return "", errors.Wrap(err, `create page failed`)
+	parts := paginateTOC(nodes, maxContentSize-navReserve, sub.title)
+	if len(parts) == 0 {
+		parts = [][]telegraph.Node{nodes}
+	}
+
+	defer res.track(StagePublish)()
+	return arc.publish(ctx, sub, parts)
+}
+
+// publish creates a Telegraph page for every part of the content, parts are linked
+// to each other. It returns the page URLs in order.
+func (arc *Archiver) publish(ctx context.Context, sub subject, parts [][]telegraph.Node) ([]string, error) {
+	stage := ErrCreatePage
+	if sub.page != nil {
+		stage = ErrEditPage
+	}
+
+	total := len(parts)
+	pages := make([]*telegraph.Page, total)
+	titles := make([]string, total)
+	pats := make([]bool, total)
+	for i, part := range parts {
+		titles[i] = partTitle(sub.title, i, total)
+		if i == 0 && sub.page != nil {
+			pages[i] = sub.page
+			continue
+		}
+		page, err := arc.client.createPage(ctx, titles[i], part, nil)
+		if errors.Is(err, ErrTitleInvalid) {
+			// Create page with random path if title illegal previous
+			page, err = arc.client.createPage(ctx, helper.RandString(6, ""), part, nil)
+			pats[i] = true
+		}
+		if err != nil {
+			return nil, newError(stage, sub.source, err)
 		}
-		pat = true
+		pages[i] = page
 	}
 
+	name, link := sub.author.byline(sub.source)
 	opts := &telegraph.EditPageOption{
-		AuthorName:    "Source",
-		AuthorURL:     sub.source,
+		AuthorName:    name,
+		AuthorURL:     link,
 		ReturnContent: false,
 	}
-	if page, err = arc.client.EditPage(page.Path, title, nodes, opts); err != nil {
-		return "", errors.Wrap(err, `edit page failed`)
+	dsts := make([]string, total)
+	for i := range parts {
+		page, err := arc.client.editPage(ctx, pages[i].Path, titles[i], navigate(parts, pages, i), opts)
+		if err != nil {
+			return nil, newError(stage, sub.source, errors.Wrap(err, `edit page failed`))
+		}
+		dsts[i] = page.URL
+		if pats[i] {
+			dsts[i] += "?title=" + url.PathEscape(titles[i])
+		}
 	}
 
-	if pat {
-		page.URL += "?title=" + url.PathEscape(title)
+	return dsts, nil
+}
+
+// Account returns the Telegraph account pages are published with,
+// loading or creating it on first use.
+func (arc *Archiver) Account(ctx context.Context) (*telegraph.Account, error) {
+	if _, err := arc.dial(ctx); err != nil {
+		return nil, err
 	}
 
-	return page.URL, nil
+	arc.RLock()
+	defer arc.RUnlock()
+	account := *arc.account
+
+	return &account, nil
 }
 
-func (arc *Archiver) newClient() (*telegraph.Client, error) {
-	client, err := telegraph.NewClient("", nil)
-	if err != nil {
-		return nil, err
+// dial returns the Telegraph client of the archiver, it is created once and
+// reused by subsequent calls.
+func (arc *Archiver) dial(ctx context.Context) (*api, error) {
+	arc.Lock()
+	defer arc.Unlock()
+
+	if arc.client != nil {
+		return arc.client, nil
 	}
-	account, err := client.CreateAccount("telegraph-go", &telegraph.CreateAccountOption{
-		AuthorName: "Anonymous",
-		AuthorURL:  "https://example.org",
-	})
+
+	client, err := arc.newClient(ctx)
 	if err != nil {
 		return nil, err
 	}
-	client.AccessToken = account.AccessToken
+	arc.client = client
 
 	return client, nil
 }
 
-func (arc *Archiver) uploadImage(fp string) ([]string, error) {
-	paths, err := arc.client.Upload([]string{fp})
-	if err != nil || len(paths) == 0 {
-		paths, err = uploadToImgbb(fp)
-		if err != nil || len(paths) == 0 {
-			return paths, err
+// dialExisting returns the Telegraph client of the archiver like dial, but returns
+// ErrNoAccount instead of creating an account if none is set or stored.
+func (arc *Archiver) dialExisting(ctx context.Context) (*api, error) {
+	arc.Lock()
+	if arc.client == nil && arc.account == nil && arc.store != nil {
+		account, err := arc.store.Load()
+		if err != nil && err != ErrNoAccount {
+			arc.Unlock()
+			return nil, errors.Wrap(err, `load account failed`)
+		}
+		arc.account = account
+	}
+	missing := arc.client == nil && arc.account == nil
+	arc.Unlock()
+
+	if missing {
+		return nil, ErrNoAccount
+	}
+	return arc.dial(ctx)
+}
+
+// anonymous returns a Telegraph client without access token, for the methods that
+// need no account.
+func (arc *Archiver) anonymous() *api {
+	client := newAPI(arc.telegraphClient(), "", arc.retryPolicy(), arc.logger())
+	if arc.baseURL != "" {
+		client.endpoint = arc.baseURL
+	}
+	return client
+}
+
+// newClient returns a Telegraph client authorized with the account set on the archiver,
+// or the one in its store, and creates an account only if none exists.
+func (arc *Archiver) newClient(ctx context.Context) (*api, error) {
+	client := arc.anonymous()
+	if arc.account == nil && arc.store != nil {
+		account, err := arc.store.Load()
+		if err != nil && err != ErrNoAccount {
+			return nil, errors.Wrap(err, `load account failed`)
+		}
+		arc.account = account
+	}
+
+	if arc.account == nil {
+		account, err := client.createAccount(ctx, arc.Author.shortName(), &telegraph.CreateAccountOption{
+			AuthorName: arc.Author.name(),
+			AuthorURL:  arc.Author.url(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if arc.store != nil {
+			if err := arc.store.Save(account); err != nil {
+				arc.logger().Error("[telegraph] save account failed: %v", err)
+			}
 		}
+		arc.account = account
 	}
-	return paths, err
+	client.AccessToken = arc.account.AccessToken
+
+	return client, nil
 }
 
-func uploadToImgbb(filename string) (paths []string, err error) {
-	url, err := imgbb.NewImgBB(nil, "").Upload(filename)
+// uploadImage uploads the image file to the configured image hosts in order,
+// and returns the URL from the first host that succeeds.
+func (arc *Archiver) uploadImage(ctx context.Context, fp string) (string, error) {
+	data, err := os.ReadFile(fp)
 	if err != nil {
-		return paths, errors.Wrap(err, fmt.Sprintf("upload image %s to ImgBB failed", filename))
+		return "", err
+	}
+	mtype := mimetype.Detect(data).String()
+
+	// Identical content is uploaded once.
+	key := contentKey(data)
+	if dst, ok := arc.imageCache().Get(key); ok {
+		arc.logger().Debug("[telegraph] image %s cached: %s", fp, dst)
+		return dst, nil
+	}
+
+	uploaders := arc.uploaders
+	if len(uploaders) == 0 {
+		uploaders = arc.defaultUploaders()
 	}
 
-	return []string{url}, nil
+	err = errors.New("no image uploader")
+	for _, uploader := range uploaders {
+		var dst string
+		err = doRetry(ctx, arc.retryPolicy(), arc.logger(), func() (err error) {
+			dst, err = uploader.Upload(ctx, bytes.NewReader(data), mtype)
+			return err
+		})
+		if err == nil && dst != "" {
+			if err := arc.imageCache().Set(key, dst); err != nil {
+				arc.logger().Error("[telegraph] cache image failed: %v", err)
+			}
+			return dst, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		arc.logger().Debug("[telegraph] upload image %s failed: %v", fp, err)
+	}
+
+	return "", errors.Wrap(err, fmt.Sprintf("upload image %s failed", fp))
 }
 
-func splitImage(name string, height int) (paths []string, err error) {
+// uploadScreenshot slices the screenshot into tiles within the Telegraph image height
+// limit and uploads them in order.
+func (arc *Archiver) uploadScreenshot(ctx context.Context, imgpath string) ([]string, error) {
+	if imgpath == "" {
+		return nil, nil
+	}
+
+	dir, err := os.MkdirTemp(arc.tmpdir(), "telegraph-tiles")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tiles, err := splitImage(imgpath, arc.tileHeight, arc.tileFormat, dir)
+	if err != nil {
+		arc.logger().Debug("[telegraph] split image failed: %v", err)
+		tiles = []string{imgpath}
+	}
+
+	var paths []string
+	for _, tile := range tiles {
+		uploaded, err := arc.uploadImage(ctx, tile)
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, uploaded)
+	}
+
+	return paths, nil
+}
+
+// splitImage slices the image into tiles no taller than height, encoded in the given format
+// and written to dir. It returns the image itself if no slicing is needed.
+func splitImage(name string, height int, format ImageFormat, dir string) (paths []string, err error) {
+	if height <= 0 {
+		height = defaultTileHeight
+	}
+
 	rd, err := os.Open(name)
 	if err != nil {
 		return paths, err
@@ -380,35 +798,35 @@ func splitImage(name string, height int) (paths []string, err error) {
 		return paths, err
 	}
 
-	round := float64(dim.Height) / float64(height)
-	point := 0
-	for round > 0 {
+	defer func() {
+		if err != nil {
+			for _, path := range paths {
+				os.Remove(path)
+			}
+			paths = nil
+		}
+	}()
+
+	bounds := img.Bounds()
+	for y := 0; y < dim.Height; y += height {
+		h := height
+		if dim.Height-y < h {
+			h = dim.Height - y
+		}
 		simg, err := cutter.Crop(img, cutter.Config{
 			Width:  dim.Width,
-			Height: height,
-			Anchor: image.Point{0, point},
+			Height: h,
+			Anchor: image.Point{bounds.Min.X, bounds.Min.Y + y},
 		})
 		if err != nil {
 			return paths, errors.Wrap(err, `crop image failed`)
 		}
 
-		if dim.Height-point < height {
-			point += dim.Height - point
-		} else {
-			point += height
+		path := filepath.Join(dir, fmt.Sprintf("tile-%03d.%s", len(paths), format.ext()))
+		if err := writeImage(simg, path, format); err != nil {
+			return paths, errors.Wrap(err, `write image failed`)
 		}
-
-		file, err := ioutil.TempFile(os.TempDir(), "telegraph-*.png")
-		if err != nil {
-			logger.Debug("[telegraph] create tmp dir failed: %v", err)
-			continue
-		}
-		if err := writeImage(simg, file.Name()); err != nil {
-			logger.Debug("[telegraph] write image failed: %v", err)
-			continue
-		}
-		paths = append(paths, file.Name())
-		round--
+		paths = append(paths, path)
 	}
 
 	return paths, nil
@@ -429,20 +847,24 @@ func readImage(name string) (image.Image, error) {
 	return img, nil
 }
 
-func writeImage(img image.Image, name string) error {
+func writeImage(img image.Image, name string, format ImageFormat) error {
 	fd, err := os.Create(name)
 	if err != nil {
 		return err
 	}
 	defer fd.Close()
 
+	if format == JPEG {
+		return jpeg.Encode(fd, img, &jpeg.Options{Quality: jpegQuality})
+	}
 	return png.Encode(fd, img)
 }
 
-// ByRemote returns Archiver with headless browser remote address.
+// ByRemote returns Archiver with headless browser remote address,
+// it is equivalent to WithBrowserRemote.
 func (arc *Archiver) ByRemote(addr string) *Archiver {
 	if addr != "" {
-		arc.browserRemoteAddr = addr
+		WithBrowserRemote(addr)(arc)
 	}
 
 	return arc
@@ -463,30 +885,9 @@ func (arc *Archiver) traverseNodes(selections *goquery.Selection) (nodes []teleg
 				}
 			case html.ElementNode:
 				attrs = map[string]string{}
-				mu := sync.Mutex{}
-				ch := make(chan string)
 				for _, attr := range node.Attr {
-					// Upload image to telegra.ph or ImgBB
-					if attr.Key == "src" || attr.Key == "data-src" {
-						logger.Debug("transferring url: %s", attr.Val)
-						go arc.transferImage(attr.Val, ch)
-					}
-				}
-				// Assign transferred URI
-				for _, attr := range node.Attr {
-					if attr.Key == "src" || attr.Key == "data-src" {
-						logger.Debug("waiting url: %s", attr.Val)
-						newurl := <-ch
-						if newurl != "" {
-							logger.Debug("newn url: %s", newurl)
-							attr.Val = newurl
-						}
-					}
-					mu.Lock()
 					attrs[attr.Key] = attr.Val
-					mu.Unlock()
 				}
-				close(ch)
 
 				if len(node.Namespace) > 0 {
 					tag = fmt.Sprintf("%s.%s", node.Namespace, node.Data)
@@ -498,9 +899,7 @@ func (arc *Archiver) traverseNodes(selections *goquery.Selection) (nodes []teleg
 					Attrs:    attrs,
 					Children: arc.traverseNodes(child.Contents()),
 				}
-				mu.Lock()
 				nodes = append(nodes, element)
-				mu.Unlock()
 			}
 		}
 	})
@@ -524,93 +923,3 @@ func castNodes(nodes []telegraph.Node) (castNodes []telegraph.Node) {
 
 	return castNodes
 }
-
-func (arc *Archiver) download(u *url.URL) (path string, err error) {
-	if !helper.IsURL(u.String()) {
-		return path, errors.Wrap(err, "invalid url")
-	}
-
-	path = filepath.Join(os.TempDir(), helper.RandString(21, "lower"))
-	fd, err := os.Create(path)
-	if err != nil {
-		return path, err
-	}
-	defer fd.Close()
-
-	resp, err := arc.Client.Get(u.String())
-	if err != nil {
-		return path, err
-	}
-	defer resp.Body.Close()
-
-	if _, err = io.Copy(fd, resp.Body); err != nil {
-		return path, err
-	}
-
-	return path, nil
-}
-
-// transferImage download image from original server and upload to Telegraph or ImgBB,
-// it returns image path or full url.
-func (arc *Archiver) transferImage(s string, c chan string) {
-	logger.Debug("[telegraph] uri: %s", s)
-	if strings.HasPrefix(s, "data:") {
-		c <- ""
-		return
-	}
-
-	u, err := url.Parse(s)
-	if err != nil {
-		logger.Error("parse uri failed: %v", err)
-		c <- ""
-		return
-	}
-
-	path, err := arc.download(u)
-	if err != nil {
-		logger.Error("download image failed: %v", err)
-		c <- ""
-		return
-	}
-	defer os.Remove(path)
-	logger.Debug("[telegraph] downloaded image path: %s", path)
-
-	mtype, err := mimetype.DetectFile(path)
-	if os.IsNotExist(err) {
-		logger.Error("file %s not exists", path)
-		c <- ""
-		return
-	}
-
-	logger.Debug("[telegraph] content type: %s", mtype.String())
-	if mtype.Is("image/webp") {
-		dst := path + ".png"
-		if err := helper.WebPToPNG(path, dst); err != nil {
-			logger.Error("[telegraph] convert webp failed: %v", err)
-		} else {
-			defer os.Remove(dst)
-			logger.Debug("[telegraph] converted image path: %s", dst)
-			path = dst
-		}
-	}
-
-	paths, err := arc.uploadImage(path)
-	if err != nil || len(paths) == 0 {
-		logger.Error("upload image failed: %v", err)
-		c <- ""
-		return
-	}
-
-	newurl := paths[0] + "?orig=" + s
-	logger.Debug("[telegraph] new uri: %s", newurl)
-
-	c <- newurl
-}
-
-func doRetry(op backoff.Operation) error {
-	exp := backoff.NewExponentialBackOff()
-	exp.MaxElapsedTime = maxElapsedTime
-	bo := backoff.WithMaxRetries(exp, maxRetries)
-
-	return backoff.Retry(op, bo)
-}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/wabarc/helper"
 	"github.com/wabarc/screenshot"
+	"github.com/wabarc/telegra.ph/phtest"
 )
 
 // nolint:errcheck
@@ -67,22 +68,37 @@ func writeHTML(content string) http.Handler {
 	})
 }
 
+// newTestArchiver returns an Archiver publishing to a fake Telegraph server.
+func newTestArchiver(t *testing.T, opts ...Option) (*Archiver, *phtest.Server) {
+	srv := phtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	opts = append([]Option{
+		WithBaseURL(srv.URL),
+		WithImageUploaders(&TelegraphUploader{Endpoint: srv.UploadURL()}),
+		WithRetryPolicy(testRetryPolicy),
+	}, opts...)
+
+	return New(opts...), srv
+}
+
 func TestPost(t *testing.T) {
 	f := genImage()
 	defer os.Remove(f.Name())
 
-	arc := &Archiver{}
-	client, err := arc.newClient()
+	arc, _ := newTestArchiver(t)
+	client, err := arc.newClient(context.Background())
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 	arc.client = client
 	sub := subject{title: []rune("testing"), source: "http://example.org"}
 
-	dest, err := arc.post(sub, "", f.Name())
+	dests, err := arc.post(context.Background(), sub, nil, []string{f.Name()})
 	if err != nil {
 		t.Fatal(err)
 	}
+	dest := dests[0]
 
 	resp, err := http.Get(dest)
 	if err != nil {
@@ -125,7 +141,7 @@ func TestWayback(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	arc := &Archiver{}
+	arc, _ := newTestArchiver(t)
 	dst, err := arc.Wayback(context.Background(), input)
 	if err != nil {
 		t.Fatal(err)
@@ -200,7 +216,8 @@ func TestWaybackByRemote(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	arc := New(nil).ByRemote(net.JoinHostPort(host, port))
+	arc, _ := newTestArchiver(t)
+	arc.ByRemote(net.JoinHostPort(host, port))
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
 	defer cancel()
 	dst, err := arc.Wayback(ctx, input)
@@ -257,7 +274,7 @@ func TestWaybackWithShots(t *testing.T) {
 	}
 	defer os.RemoveAll(dirname)
 
-	arc := &Archiver{}
+	arc, _ := newTestArchiver(t)
 	ctx := context.Background()
 	files := screenshot.Files{
 		Image: path.Join(dirname, "image.png"),
@@ -291,10 +308,91 @@ func TestSplitImage(t *testing.T) {
 	file := genImage()
 	defer os.Remove(file.Name())
 
-	paths, err := splitImage(file.Name(), 8976)
-	if err != nil {
-		t.Log(err)
-		t.Log(paths)
-		t.Fail()
+	tests := []struct {
+		height int
+		format ImageFormat
+		tiles  int
+	}{
+		{12000, PNG, 1},
+		{8976, PNG, 2},
+		{4000, JPEG, 3},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		paths, err := splitImage(file.Name(), test.height, test.format, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != test.tiles {
+			t.Fatalf("Unexpected tiles, got %d instead of %d", len(paths), test.tiles)
+		}
+		if test.tiles == 1 {
+			continue
+		}
+
+		height := 0
+		for _, path := range paths {
+			img, err := readImage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := img.Bounds().Dy(); h > test.height {
+				t.Errorf("Unexpected tile height, got %d larger than %d", h, test.height)
+			}
+			height += img.Bounds().Dy()
+		}
+		if height != 10000 {
+			t.Errorf("Unexpected total height of tiles, got %d instead of 10000", height)
+		}
+	}
+}
+
+type recordLogger struct {
+	debug, error int
+}
+
+func (l *recordLogger) Debug(format string, v ...interface{}) { l.debug++ }
+func (l *recordLogger) Error(format string, v ...interface{}) { l.error++ }
+
+func TestNewOptions(t *testing.T) {
+	arc := New()
+	if arc.Client == nil || arc.Client.Timeout != timeout {
+		t.Fatalf("Unexpected default client, got %v", arc.Client)
+	}
+	if arc.tmpdir() != os.TempDir() {
+		t.Errorf("Unexpected temp dir, got %s instead of %s", arc.tmpdir(), os.TempDir())
+	}
+
+	dir := t.TempDir()
+	log := &recordLogger{}
+	arc = New(
+		WithTimeout(time.Second),
+		WithBrowserRemote("127.0.0.1:9222"),
+		WithTempDir(dir),
+		WithLogger(log),
+	)
+	if arc.Client.Timeout != time.Second {
+		t.Errorf("Unexpected client timeout, got %s instead of %s", arc.Client.Timeout, time.Second)
+	}
+	if arc.browserRemoteAddr != "127.0.0.1:9222" {
+		t.Errorf("Unexpected browser remote address, got %s instead of 127.0.0.1:9222", arc.browserRemoteAddr)
+	}
+	if arc.tmpdir() != dir {
+		t.Errorf("Unexpected temp dir, got %s instead of %s", arc.tmpdir(), dir)
+	}
+	arc.logger().Debug("test")
+	if log.debug != 1 {
+		t.Errorf("Unexpected debug messages, got %d instead of 1", log.debug)
+	}
+
+	client := &http.Client{}
+	if arc = New(WithHTTPClient(client), WithTimeout(time.Second)); arc.Client != client {
+		t.Errorf("Unexpected client, got %v instead of %v", arc.Client, client)
+	}
+
+	// Nil options are skipped.
+	if arc = New(nil, WithTempDir(dir)); arc.tmpdir() != dir {
+		t.Errorf("Unexpected temp dir, got %s instead of %s", arc.tmpdir(), dir)
 	}
 }
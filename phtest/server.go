@@ -0,0 +1,502 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package phtest provides a fake Telegraph API server for testing and offline development.
+
+The server keeps accounts, pages and uploaded files in memory, and serves pages and
+files back by path so that published URLs can be fetched. Point an archiver to it with
+the base URL and upload URL of the server:
+
+	srv := phtest.NewServer()
+	defer srv.Close()
+
+	arc := ph.New(
+		ph.WithBaseURL(srv.URL),
+		ph.WithImageUploaders(&ph.TelegraphUploader{Endpoint: srv.UploadURL()}),
+	)
+*/
+package phtest // import "github.com/wabarc/telegra.ph/phtest"
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+// Limits enforced like the Telegraph API.
+const (
+	MaxTitleLength = 256
+	MaxContentSize = 64 * 1024
+	MaxUploadSize  = 5 * 1024 * 1024
+)
+
+// Server is a fake Telegraph API server.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	accounts map[string]*telegraph.Account
+	pages    map[string]*page
+	order    []string
+	files    map[string]file
+	failures []string
+	calls    map[string]int
+}
+
+type page struct {
+	telegraph.Page
+
+	token string
+}
+
+type file struct {
+	mime string
+	data []byte
+}
+
+// NewServer starts and returns a new Server, the caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		accounts: make(map[string]*telegraph.Account),
+		pages:    make(map[string]*page),
+		files:    make(map[string]file),
+		calls:    make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", s.upload)
+	mux.HandleFunc("/file/", s.serveFile)
+	mux.HandleFunc("/", s.serve)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// UploadURL returns the URL images are uploaded to.
+func (s *Server) UploadURL() string {
+	return s.URL + "/upload"
+}
+
+// FailNext makes the next n API calls fail with the error message, e.g. "FLOOD_WAIT_3".
+func (s *Server) FailNext(n int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, message)
+	}
+}
+
+// FloodWait makes the next n API calls fail with flood control asking to wait for seconds.
+func (s *Server) FloodWait(n, seconds int) {
+	s.FailNext(n, "FLOOD_WAIT_"+strconv.Itoa(seconds))
+}
+
+// Page returns the stored page at path.
+func (s *Server) Page(path string) (telegraph.Page, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.pages[path]
+	if !ok {
+		return telegraph.Page{}, false
+	}
+	return p.Page, true
+}
+
+// Pages returns all stored pages in order of creation.
+func (s *Server) Pages() []telegraph.Page {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pages := make([]telegraph.Page, 0, len(s.order))
+	for _, path := range s.order {
+		pages = append(pages, s.pages[path].Page)
+	}
+	return pages
+}
+
+// Files returns the number of uploaded files.
+func (s *Server) Files() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.files)
+}
+
+// Calls returns the number of calls of the API method, e.g. "createPage", failed calls
+// included.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[method]
+}
+
+type apiError string
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	method := strings.Trim(r.URL.Path, "/")
+	handlers := map[string]func(r *http.Request) (interface{}, apiError){
+		"createAccount":  s.createAccount,
+		"getAccountInfo": s.getAccountInfo,
+		"createPage":     s.createPage,
+		"editPage":       s.editPage,
+		"getPage":        s.getPage,
+		"getPageList":    s.getPageList,
+		"getViews":       s.getViews,
+	}
+	handler, ok := handlers[method]
+	if !ok {
+		s.servePage(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "INVALID_REQUEST"})
+		return
+	}
+
+	s.mu.Lock()
+	s.calls[method]++
+	var result interface{}
+	var failure apiError
+	if len(s.failures) > 0 {
+		failure, s.failures = apiError(s.failures[0]), s.failures[1:]
+	} else {
+		result, failure = handler(r)
+	}
+	s.mu.Unlock()
+
+	if failure != "" {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": string(failure)})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"ok": true, "result": result})
+}
+
+func (s *Server) createAccount(r *http.Request) (interface{}, apiError) {
+	name := r.Form.Get("short_name")
+	if name == "" || utf8.RuneCountInString(name) > 32 {
+		return nil, "SHORT_NAME_REQUIRED"
+	}
+
+	account := &telegraph.Account{
+		ShortName:   name,
+		AuthorName:  r.Form.Get("author_name"),
+		AuthorURL:   r.Form.Get("author_url"),
+		AccessToken: randHex(20),
+	}
+	s.accounts[account.AccessToken] = account
+
+	return account, ""
+}
+
+func (s *Server) getAccountInfo(r *http.Request) (interface{}, apiError) {
+	account, err := s.account(r)
+	if err != "" {
+		return nil, err
+	}
+
+	info := *account
+	info.AccessToken = ""
+	for _, p := range s.pages {
+		if p.token == account.AccessToken {
+			info.PageCount++
+		}
+	}
+	return info, ""
+}
+
+func (s *Server) createPage(r *http.Request) (interface{}, apiError) {
+	account, err := s.account(r)
+	if err != "" {
+		return nil, err
+	}
+	title, content, err := pageContent(r)
+	if err != "" {
+		return nil, err
+	}
+
+	path := s.newPath(title)
+	p := &page{
+		Page: telegraph.Page{
+			Path:       path,
+			URL:        s.URL + "/" + path,
+			Title:      title,
+			AuthorName: authorName(r, account),
+			AuthorURL:  authorURL(r, account),
+			Content:    content,
+			CanEdit:    true,
+		},
+		token: account.AccessToken,
+	}
+	s.pages[path] = p
+	s.order = append(s.order, path)
+
+	return result(p, r), ""
+}
+
+func (s *Server) editPage(r *http.Request) (interface{}, apiError) {
+	account, err := s.account(r)
+	if err != "" {
+		return nil, err
+	}
+	p, ok := s.pages[pagePath(r)]
+	if !ok {
+		return nil, "PAGE_NOT_FOUND"
+	}
+	if p.token != account.AccessToken {
+		return nil, "PAGE_ACCESS_DENIED"
+	}
+	title, content, err := pageContent(r)
+	if err != "" {
+		return nil, err
+	}
+
+	p.Title = title
+	p.Content = content
+	p.AuthorName = authorName(r, account)
+	p.AuthorURL = authorURL(r, account)
+
+	return result(p, r), ""
+}
+
+func (s *Server) getPage(r *http.Request) (interface{}, apiError) {
+	p, ok := s.pages[pagePath(r)]
+	if !ok {
+		return nil, "PAGE_NOT_FOUND"
+	}
+	return result(p, r), ""
+}
+
+func (s *Server) getPageList(r *http.Request) (interface{}, apiError) {
+	account, err := s.account(r)
+	if err != "" {
+		return nil, err
+	}
+	offset, _ := strconv.Atoi(r.Form.Get("offset"))
+	limit, e := strconv.Atoi(r.Form.Get("limit"))
+	if e != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	list := telegraph.PageList{Pages: []telegraph.Page{}}
+	// Most recent first
+	for i := len(s.order) - 1; i >= 0; i-- {
+		p := s.pages[s.order[i]]
+		if p.token != account.AccessToken {
+			continue
+		}
+		if list.TotalCount >= offset && len(list.Pages) < limit {
+			summary := p.Page
+			summary.Content = nil
+			list.Pages = append(list.Pages, summary)
+		}
+		list.TotalCount++
+	}
+
+	return list, ""
+}
+
+func (s *Server) getViews(r *http.Request) (interface{}, apiError) {
+	p, ok := s.pages[pagePath(r)]
+	if !ok {
+		return nil, "PAGE_NOT_FOUND"
+	}
+	return telegraph.PageViews{Views: p.Views}, ""
+}
+
+func (s *Server) account(r *http.Request) (*telegraph.Account, apiError) {
+	account, ok := s.accounts[r.Form.Get("access_token")]
+	if !ok {
+		return nil, "ACCESS_TOKEN_INVALID"
+	}
+	return account, ""
+}
+
+// newPath returns a path for the title like Telegraph does, e.g. Title-01-02-3.
+func (s *Server) newPath(title string) string {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '-'
+	}, title)
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		slug = "Page"
+	}
+
+	base := slug + time.Now().Format("-01-02")
+	path := base
+	for i := 2; s.pages[path] != nil; i++ {
+		path = base + "-" + strconv.Itoa(i)
+	}
+	return path
+}
+
+// upload stores the images of a multipart upload.
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(MaxUploadSize); err != nil {
+		writeJSON(w, map[string]string{"error": "Bad Request"})
+		return
+	}
+
+	var files []map[string]string
+	for _, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			if header.Size > MaxUploadSize {
+				writeJSON(w, map[string]string{"error": "File too big"})
+				return
+			}
+			f, err := header.Open()
+			if err != nil {
+				writeJSON(w, map[string]string{"error": "Bad Request"})
+				return
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				writeJSON(w, map[string]string{"error": "Bad Request"})
+				return
+			}
+			mime := http.DetectContentType(data)
+			if !strings.HasPrefix(mime, "image/") && !strings.HasPrefix(mime, "video/") {
+				writeJSON(w, map[string]string{"error": "File type invalid"})
+				return
+			}
+
+			name := randHex(8) + path.Ext(header.Filename)
+			s.mu.Lock()
+			s.files[name] = file{mime: mime, data: data}
+			s.mu.Unlock()
+			files = append(files, map[string]string{"src": "/file/" + name})
+		}
+	}
+	if len(files) == 0 {
+		writeJSON(w, map[string]string{"error": "No files passed"})
+		return
+	}
+
+	writeJSON(w, files)
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f, ok := s.files[strings.TrimPrefix(r.URL.Path, "/file/")]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", f.mime)
+	w.Write(f.data) // nolint:errcheck
+}
+
+// servePage renders the page at the request path and counts the view.
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	p, ok := s.pages[strings.Trim(r.URL.Path, "/")]
+	if ok {
+		p.Views++
+	}
+	var buf []byte
+	if ok {
+		buf, _ = json.Marshal(p.Content)
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>%s</title></head><body><article data-content=\"%s\"></article></body></html>",
+		html.EscapeString(p.Title), html.EscapeString(string(buf)))
+}
+
+// pageContent validates the title and content parameters like Telegraph does.
+func pageContent(r *http.Request) (string, []telegraph.Node, apiError) {
+	title := r.Form.Get("title")
+	if strings.TrimSpace(title) == "" {
+		return "", nil, "TITLE_INVALID"
+	}
+	if utf8.RuneCountInString(title) > MaxTitleLength {
+		return "", nil, "TITLE_TOO_LONG"
+	}
+
+	raw := r.Form.Get("content")
+	if raw == "" {
+		return "", nil, "CONTENT_REQUIRED"
+	}
+	if len(raw) > MaxContentSize {
+		return "", nil, "CONTENT_TOO_BIG"
+	}
+	var content []telegraph.Node
+	if err := json.Unmarshal([]byte(raw), &content); err != nil {
+		return "", nil, "CONTENT_INVALID"
+	}
+	if len(content) == 0 {
+		return "", nil, "CONTENT_REQUIRED"
+	}
+
+	return title, content, ""
+}
+
+func pagePath(r *http.Request) string {
+	return strings.Trim(r.Form.Get("path"), "/")
+}
+
+func authorName(r *http.Request, account *telegraph.Account) string {
+	if name := r.Form.Get("author_name"); name != "" {
+		return name
+	}
+	return account.AuthorName
+}
+
+func authorURL(r *http.Request, account *telegraph.Account) string {
+	if u := r.Form.Get("author_url"); u != "" {
+		return u
+	}
+	return account.AuthorURL
+}
+
+// result returns the page as the API does, with content only if asked for.
+func result(p *page, r *http.Request) telegraph.Page {
+	page := p.Page
+	if r.Form.Get("return_content") != "true" {
+		page.Content = nil
+	}
+	return page
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) // nolint:errcheck
+}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b) // nolint:errcheck
+	return hex.EncodeToString(b)
+}
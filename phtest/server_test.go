@@ -0,0 +1,145 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package phtest // import "github.com/wabarc/telegra.ph/phtest"
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type response struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+func call(t *testing.T, srv *Server, method string, params url.Values) response {
+	t.Helper()
+
+	resp, err := http.PostForm(srv.URL+"/"+method, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	res := call(t, srv, "createAccount", url.Values{"short_name": {"wabarc"}})
+	var account struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(res.Result, &account); err != nil || account.AccessToken == "" {
+		t.Fatalf("Unexpected account, got %s", res.Result)
+	}
+	token := account.AccessToken
+
+	tests := []struct {
+		name   string
+		method string
+		params url.Values
+		err    string
+	}{
+		{"invalid token", "createPage", url.Values{"access_token": {"x"}, "title": {"Title"}, "content": {`["text"]`}}, "ACCESS_TOKEN_INVALID"},
+		{"empty title", "createPage", url.Values{"access_token": {token}, "title": {" "}, "content": {`["text"]`}}, "TITLE_INVALID"},
+		{"long title", "createPage", url.Values{"access_token": {token}, "title": {strings.Repeat("a", MaxTitleLength+1)}, "content": {`["text"]`}}, "TITLE_TOO_LONG"},
+		{"large content", "createPage", url.Values{"access_token": {token}, "title": {"Title"}, "content": {`["` + strings.Repeat("a", MaxContentSize) + `"]`}}, "CONTENT_TOO_BIG"},
+		{"invalid content", "createPage", url.Values{"access_token": {token}, "title": {"Title"}, "content": {`{}`}}, "CONTENT_INVALID"},
+		{"missing page", "getPage", url.Values{"path": {"Missing"}}, "PAGE_NOT_FOUND"},
+		{"created", "createPage", url.Values{"access_token": {token}, "title": {"Hello, World"}, "content": {`["text"]`}}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := call(t, srv, test.method, test.params)
+			if res.Error != test.err {
+				t.Errorf("Unexpected error, got %q instead of %q", res.Error, test.err)
+			}
+		})
+	}
+
+	pages := srv.Pages()
+	if len(pages) != 1 || !strings.HasPrefix(pages[0].Path, "Hello-World-") {
+		t.Fatalf("Unexpected pages, got %#v", pages)
+	}
+	resp, err := http.Get(pages[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected status of page, got %d instead of 200", resp.StatusCode)
+	}
+
+	res = call(t, srv, "editPage", url.Values{"access_token": {token}, "path": {pages[0].Path}, "title": {"Edited"}, "content": {`["text"]`}})
+	if !res.OK {
+		t.Errorf("Unexpected edit failure: %s", res.Error)
+	}
+	if page, _ := srv.Page(pages[0].Path); page.Title != "Edited" || page.Views != 1 {
+		t.Errorf("Unexpected page, got %#v", page)
+	}
+
+	srv.FloodWait(1, 3)
+	if res := call(t, srv, "getPage", url.Values{"path": {pages[0].Path}}); res.Error != "FLOOD_WAIT_3" {
+		t.Errorf("Unexpected error, got %q instead of FLOOD_WAIT_3", res.Error)
+	}
+	if res := call(t, srv, "getPage", url.Values{"path": {pages[0].Path}}); !res.OK {
+		t.Errorf("Unexpected error, got %q", res.Error)
+	}
+	if calls := srv.Calls("getPage"); calls != 3 {
+		t.Errorf("Unexpected calls of getPage, got %d instead of 3", calls)
+	}
+}
+
+// nolint:errcheck
+func TestUpload(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	part, _ := w.CreateFormFile("file", "image.png")
+	part.Write(img.Bytes())
+	w.Close()
+
+	resp, err := http.Post(srv.UploadURL(), w.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var files []struct {
+		Src string `json:"src"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil || len(files) != 1 {
+		t.Fatalf("Unexpected upload response: %v", err)
+	}
+
+	file, err := http.Get(srv.URL + files[0].Src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Body.Close()
+	if file.StatusCode != http.StatusOK || file.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("Unexpected uploaded file, got status %d and type %s", file.StatusCode, file.Header.Get("Content-Type"))
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package queue // import "github.com/wabarc/telegra.ph/queue"
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// compactAfter is the number of journal entries written before the journal is
+// compacted, if it holds more than twice as many entries as items.
+const compactAfter = 1024
+
+// FileQueue is a Queue kept in memory and journaled to a file, one JSON item per
+// line. Every change is appended and synced before it returns, the journal is
+// compacted when opened and as it grows.
+type FileQueue struct {
+	mu      sync.Mutex
+	path    string
+	lock    *os.File
+	file    *os.File
+	items   map[string]*Item
+	order   []string
+	entries int
+}
+
+var _ Queue = (*FileQueue)(nil)
+
+// OpenFile opens the queue journaled to the file at path, creating it if missing.
+// Items left running by a previous process are made pending again. The queue is
+// locked by the file at path with the .lock suffix until closed, opening it while
+// another process has it open returns ErrLocked.
+func OpenFile(path string) (*FileQueue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, errors.Wrap(err, "create queue directory failed")
+	}
+	// The journal is replaced on compaction, the lock is taken on a file kept in place.
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "open queue lock failed")
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		if err == ErrLocked {
+			return nil, ErrLocked
+		}
+		return nil, errors.Wrap(err, "lock queue failed")
+	}
+
+	q := &FileQueue{path: path, lock: lock, items: make(map[string]*Item)}
+	if err := q.load(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	for _, item := range q.items {
+		if item.Status == StatusRunning {
+			item.Status = StatusPending
+		}
+	}
+	if err := q.compact(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// load replays the journal, the last entry of an item wins. A line cut by a crash
+// is skipped.
+func (q *FileQueue) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "open queue failed")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var item Item
+		if json.Unmarshal(scanner.Bytes(), &item) != nil || item.ID == "" {
+			continue
+		}
+		if _, ok := q.items[item.ID]; !ok {
+			q.order = append(q.order, item.ID)
+		}
+		q.items[item.ID] = &item
+	}
+	return errors.Wrap(scanner.Err(), "read queue failed")
+}
+
+// compact rewrites the journal with the current items and reopens it for appending.
+func (q *FileQueue) compact() error {
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o700); err != nil {
+		return errors.Wrap(err, "create queue directory failed")
+	}
+
+	// Write to a temporary file first to keep the journal intact if writing fails.
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "write queue failed")
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, id := range q.order {
+		if err := enc.Encode(q.items[id]); err != nil {
+			f.Close()
+			return errors.Wrap(err, "write queue failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write queue failed")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write queue failed")
+	}
+	f.Close()
+	if err := os.Rename(tmp, q.path); err != nil {
+		return errors.Wrap(err, "write queue failed")
+	}
+
+	q.file, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "open queue failed")
+	}
+	q.entries = len(q.order)
+	return nil
+}
+
+// write journals the item, q.mu must be held.
+func (q *FileQueue) write(item *Item) error {
+	if q.file == nil {
+		return errors.New("queue closed")
+	}
+	buf, err := json.Marshal(item)
+	if err != nil {
+		return errors.Wrap(err, "encode item failed")
+	}
+	if _, err := q.file.Write(append(buf, '\n')); err != nil {
+		return errors.Wrap(err, "write queue failed")
+	}
+	if err := q.file.Sync(); err != nil {
+		return errors.Wrap(err, "write queue failed")
+	}
+
+	q.entries++
+	if q.entries > compactAfter && q.entries > 2*len(q.order) {
+		return q.compact()
+	}
+	return nil
+}
+
+// Enqueue adds a pending item of the URL.
+func (q *FileQueue) Enqueue(link string) (Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	item := &Item{ID: newID(), URL: link, Status: StatusPending, Created: now, Updated: now}
+	if err := q.write(item); err != nil {
+		return Item{}, err
+	}
+	q.items[item.ID] = item
+	q.order = append(q.order, item.ID)
+
+	return *item, nil
+}
+
+// Next claims the oldest pending item due by now and marks it running.
+func (q *FileQueue) Next() (Item, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for _, id := range q.order {
+		item := q.items[id]
+		if item.Status != StatusPending || item.NotBefore.After(now) {
+			continue
+		}
+		next := *item
+		next.Status = StatusRunning
+		next.Updated = now
+		if err := q.write(&next); err != nil {
+			return Item{}, false, err
+		}
+		*item = next
+		return next, true, nil
+	}
+	return Item{}, false, nil
+}
+
+// Update stores the item, replacing the item of the same ID.
+func (q *FileQueue) Update(item Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	current, ok := q.items[item.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	item.Updated = time.Now()
+	if err := q.write(&item); err != nil {
+		return err
+	}
+	*current = item
+	return nil
+}
+
+// Get returns the item of the ID, or ErrNotFound.
+func (q *FileQueue) Get(id string) (Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.items[id]
+	if !ok {
+		return Item{}, ErrNotFound
+	}
+	return *item, nil
+}
+
+// List returns all items in the order they were enqueued.
+func (q *FileQueue) List() ([]Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]Item, 0, len(q.order))
+	for _, id := range q.order {
+		items = append(items, *q.items[id])
+	}
+	return items, nil
+}
+
+// Close closes the journal.
+func (q *FileQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	q.lock.Close()
+	return err
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b) // nolint:errcheck
+	return hex.EncodeToString(b)
+}
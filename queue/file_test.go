@@ -0,0 +1,139 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package queue // import "github.com/wabarc/telegra.ph/queue"
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	q, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	first, err := q.Enqueue("https://example.org/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := q.Enqueue("https://example.org/2")
+
+	item, ok, err := q.Next()
+	if err != nil || !ok {
+		t.Fatalf("Unexpected next, got %v %v", ok, err)
+	}
+	if item.ID != first.ID || item.Status != StatusRunning {
+		t.Errorf("Unexpected item, got %+v instead of %s running", item, first.ID)
+	}
+
+	// Delayed items are not due.
+	item.Status = StatusPending
+	item.NotBefore = time.Now().Add(time.Hour)
+	if err := q.Update(item); err != nil {
+		t.Fatal(err)
+	}
+	item, ok, _ = q.Next()
+	if !ok || item.ID != second.ID {
+		t.Errorf("Unexpected item, got %+v instead of %s", item, second.ID)
+	}
+	if _, ok, _ := q.Next(); ok {
+		t.Errorf("Unexpected next, got an item instead of none")
+	}
+
+	item.Status = StatusDone
+	item.Result = []string{"https://telegra.ph/Example-01-01"}
+	if err := q.Update(item); err != nil {
+		t.Fatal(err)
+	}
+	got, err := q.Get(second.ID)
+	if err != nil || got.Status != StatusDone || len(got.Result) != 1 {
+		t.Errorf("Unexpected item, got %+v %v", got, err)
+	}
+	if _, err := q.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unexpected error, got %v instead of %v", err, ErrNotFound)
+	}
+	if err := q.Update(Item{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unexpected error, got %v instead of %v", err, ErrNotFound)
+	}
+}
+
+func TestFileQueueReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	q, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := q.Enqueue("https://example.org/1")
+	second, _ := q.Enqueue("https://example.org/2")
+	q.Next() // nolint:errcheck
+	q.Close()
+
+	// A line cut by a crash.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	f.WriteString(`{"id":"cut","url":"https://exa`) // nolint:errcheck
+	f.Close()
+
+	q, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	items, _ := q.List()
+	if len(items) != 2 || items[0].ID != first.ID || items[1].ID != second.ID {
+		t.Fatalf("Unexpected items, got %+v", items)
+	}
+	if items[0].Status != StatusPending {
+		t.Errorf("Unexpected status of the interrupted item, got %s instead of %s", items[0].Status, StatusPending)
+	}
+}
+
+func TestFileQueueCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	q, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	item, _ := q.Enqueue("https://example.org/")
+	for i := 0; i < compactAfter+1; i++ {
+		item.Attempts = i
+		if err := q.Update(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.entries > compactAfter {
+		t.Errorf("Unexpected journal entries, got %d after compaction", q.entries)
+	}
+	got, _ := q.Get(item.ID)
+	if got.Attempts != compactAfter {
+		t.Errorf("Unexpected attempts, got %d instead of %d", got.Attempts, compactAfter)
+	}
+}
+
+func TestFileQueueLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	q, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(path); !errors.Is(err, ErrLocked) {
+		t.Errorf("Unexpected error, got %v instead of %v", err, ErrLocked)
+	}
+
+	q.Close()
+	q, err = OpenFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error after close, got %v", err)
+	}
+	q.Close()
+}
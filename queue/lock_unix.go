@@ -0,0 +1,22 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package queue // import "github.com/wabarc/telegra.ph/queue"
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock of the file without waiting, ErrLocked is returned
+// if another process holds it. The lock is released when the file is closed.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrLocked
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package queue archives URLs asynchronously from a persistent queue, so that large
+backlogs survive restarts.
+
+URLs are enqueued to a Queue and processed by the workers of a Worker. Temporary
+failures, as reported by ph.Temporary, are retried with exponential backoff, other
+failures and URLs out of attempts are marked failed. Items left running by a crash
+are processed again once the queue is reopened. A queue file is open in one process
+at a time:
+
+	q, err := queue.OpenFile("queue.jsonl")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	q.Enqueue("https://www.eff.org/")
+	queue.NewWorker(q, ph.New()).Run(ctx)
+*/
+package queue // import "github.com/wabarc/telegra.ph/queue"
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status is the state of an Item.
+type Status string
+
+// Item states.
+const (
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+var (
+	// ErrNotFound is returned for an unknown item.
+	ErrNotFound = errors.New("item not found")
+
+	// ErrLocked is returned when opening a queue another process has open.
+	ErrLocked = errors.New("queue locked by another process")
+)
+
+// Item is a URL in the queue.
+type Item struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Status Status `json:"status"`
+
+	// Attempts is the number of times the URL has been processed.
+	Attempts int `json:"attempts"`
+
+	// NotBefore delays the next attempt of a pending item.
+	NotBefore time.Time `json:"not_before,omitempty"`
+
+	// Result holds the Telegraph URLs of a done item.
+	Result []string `json:"result,omitempty"`
+
+	// Error is the last failure.
+	Error string `json:"error,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Queue is a persistent queue of URLs, safe for concurrent use.
+type Queue interface {
+	// Enqueue adds a pending item of the URL.
+	Enqueue(link string) (Item, error)
+
+	// Next claims the oldest pending item due by now and marks it running, ok is
+	// false if there is none.
+	Next() (item Item, ok bool, err error)
+
+	// Update stores the item, replacing the item of the same ID.
+	Update(item Item) error
+
+	// Get returns the item of the ID, or ErrNotFound.
+	Get(id string) (Item, error)
+
+	// List returns all items in the order they were enqueued.
+	List() ([]Item, error)
+
+	// Close releases the queue.
+	Close() error
+}
@@ -0,0 +1,258 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package queue // import "github.com/wabarc/telegra.ph/queue"
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wabarc/telegra.ph"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultMaxAttempts  = 5
+	defaultTimeout      = 5 * time.Minute
+	defaultBackoff      = 30 * time.Second
+	defaultMaxBackoff   = time.Hour
+	defaultPollInterval = time.Second
+)
+
+// Worker processes the items of a queue with the archiver.
+type Worker struct {
+	queue Queue
+	arc   *ph.Archiver
+	mode  ph.Mode
+
+	workers     int
+	maxAttempts int
+	timeout     time.Duration
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	poll        time.Duration
+}
+
+// Option configures the Worker.
+type Option func(*Worker)
+
+// WithWorkers sets the number of items processed at once, defaults to 4.
+func WithWorkers(n int) Option {
+	return func(w *Worker) {
+		w.workers = n
+	}
+}
+
+// WithMaxAttempts sets the attempts of an item before it is marked failed, defaults to 5.
+func WithMaxAttempts(n int) Option {
+	return func(w *Worker) {
+		w.maxAttempts = n
+	}
+}
+
+// WithTimeout sets the timeout of each attempt, defaults to 5 minutes.
+func WithTimeout(d time.Duration) Option {
+	return func(w *Worker) {
+		w.timeout = d
+	}
+}
+
+// WithBackoff sets the wait before the first retry, it doubles with every attempt up
+// to max. Defaults to 30 seconds up to an hour.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(w *Worker) {
+		w.backoff = initial
+		w.maxBackoff = max
+	}
+}
+
+// WithPollInterval sets how often an idle worker looks for due items, defaults to a second.
+func WithPollInterval(d time.Duration) Option {
+	return func(w *Worker) {
+		w.poll = d
+	}
+}
+
+// WithMode sets the mode items are archived in, defaults to ph.ModeFull.
+func WithMode(mode ph.Mode) Option {
+	return func(w *Worker) {
+		w.mode = mode
+	}
+}
+
+// NewWorker returns a Worker processing the queue with the archiver.
+func NewWorker(q Queue, arc *ph.Archiver, opts ...Option) *Worker {
+	w := &Worker{queue: q, arc: arc}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.workers <= 0 {
+		w.workers = defaultWorkers
+	}
+	if w.maxAttempts <= 0 {
+		w.maxAttempts = defaultMaxAttempts
+	}
+	if w.timeout <= 0 {
+		w.timeout = defaultTimeout
+	}
+	if w.backoff <= 0 {
+		w.backoff = defaultBackoff
+	}
+	if w.maxBackoff < w.backoff {
+		w.maxBackoff = defaultMaxBackoff
+	}
+	if w.poll <= 0 {
+		w.poll = defaultPollInterval
+	}
+	return w
+}
+
+// Run processes items until ctx is done, it returns the first error of the queue.
+// Items interrupted by ctx are put back to pending without using up an attempt.
+func (w *Worker) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var failure error
+	var wg sync.WaitGroup
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.loop(ctx); err != nil {
+				once.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	return failure
+}
+
+// Drain processes items until none is pending, waiting for items delayed by backoff.
+func (w *Worker) Drain(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+
+	ticker := time.NewTicker(w.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case <-ticker.C:
+		}
+		items, err := w.queue.List()
+		if err != nil {
+			cancel()
+			<-errc
+			return err
+		}
+		if !unfinished(items) {
+			cancel()
+			return <-errc
+		}
+	}
+}
+
+func unfinished(items []Item) bool {
+	for _, item := range items {
+		if item.Status == StatusPending || item.Status == StatusRunning {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Worker) loop(ctx context.Context) error {
+	for {
+		item, ok, err := w.queue.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(w.poll):
+				continue
+			}
+		}
+		if err := w.queue.Update(w.process(ctx, item)); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// process archives the item and returns it updated with the outcome.
+func (w *Worker) process(ctx context.Context, item Item) Item {
+	u, err := url.Parse(item.URL)
+	if err != nil {
+		item.Attempts++
+		item.Status = StatusFailed
+		item.Error = errors.Wrap(err, "invalid url").Error()
+		return item
+	}
+
+	actx, cancel := context.WithTimeout(ctx, w.timeout)
+	dsts, err := w.arc.WaybackAll(w.arc.WithMode(actx, w.mode), u)
+	cancel()
+
+	if ctx.Err() != nil {
+		// Interrupted by shutdown, not a failure of the URL.
+		item.Status = StatusPending
+		return item
+	}
+
+	item.Attempts++
+	if err == nil {
+		item.Status = StatusDone
+		item.Result = dsts
+		item.Error = ""
+		item.NotBefore = time.Time{}
+		return item
+	}
+
+	item.Error = err.Error()
+	if !ph.Temporary(err) || item.Attempts >= w.maxAttempts {
+		item.Status = StatusFailed
+		return item
+	}
+	item.Status = StatusPending
+	item.NotBefore = time.Now().Add(w.delay(item.Attempts, err))
+	return item
+}
+
+// delay returns the wait before the next attempt, at least the wait asked by
+// Telegraph flood control.
+func (w *Worker) delay(attempts int, err error) time.Duration {
+	d := w.backoff
+	for i := 1; i < attempts && d < w.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.maxBackoff {
+		d = w.maxBackoff
+	}
+
+	var fw *ph.ErrFloodWait
+	if errors.As(err, &fw) && fw.RetryAfter > d {
+		d = fw.RetryAfter
+	}
+	return d
+}
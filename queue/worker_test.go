@@ -0,0 +1,134 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package queue // import "github.com/wabarc/telegra.ph/queue"
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wabarc/telegra.ph"
+	"github.com/wabarc/telegra.ph/phtest"
+)
+
+const articleHTML = `<html><head><title>Archiving the Web</title></head><body>
+<article><h1>Archiving the Web</h1>
+<p>Web archiving is the process of collecting portions of the World Wide Web to ensure the information is preserved in an archive for future researchers, historians, and the public.</p>
+<p>Web archivists typically employ web crawlers for automated capture due to the massive size and amount of information on the Web. The largest web archiving organization based on a bulk crawling approach is the Wayback Machine.</p>
+</article></body></html>`
+
+func newTestWorker(t *testing.T, opts ...Option) (*Worker, *FileQueue, *phtest.Server, string) {
+	tg := phtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			io.WriteString(w, `<html><body></body></html>`) // nolint:errcheck
+			return
+		}
+		io.WriteString(w, articleHTML) // nolint:errcheck
+	}))
+	t.Cleanup(source.Close)
+
+	q, err := OpenFile(filepath.Join(t.TempDir(), "queue.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+
+	arc := ph.New(
+		ph.WithBaseURL(tg.URL),
+		ph.WithImageUploaders(&ph.TelegraphUploader{Endpoint: tg.UploadURL()}),
+		ph.WithRetryPolicy(ph.RetryPolicy{}),
+	)
+	opts = append([]Option{
+		WithMode(ph.ModeArticle),
+		WithBackoff(10*time.Millisecond, 10*time.Millisecond),
+		WithPollInterval(10 * time.Millisecond),
+		WithTimeout(30 * time.Second),
+	}, opts...)
+
+	return NewWorker(q, arc, opts...), q, tg, source.URL
+}
+
+func drain(t *testing.T, w *Worker) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := w.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorker(t *testing.T) {
+	w, q, tg, source := newTestWorker(t)
+
+	done, _ := q.Enqueue(source + "/article")
+	failed, _ := q.Enqueue(source + "/empty")
+	drain(t, w)
+
+	item, _ := q.Get(done.ID)
+	if item.Status != StatusDone || len(item.Result) != 1 || item.Attempts != 1 {
+		t.Errorf("Unexpected item, got %+v", item)
+	}
+	if len(tg.Pages()) != 1 {
+		t.Errorf("Unexpected pages, got %d instead of 1", len(tg.Pages()))
+	}
+
+	// Pages without an article fail permanently.
+	item, _ = q.Get(failed.ID)
+	if item.Status != StatusFailed || item.Attempts != 1 || item.Error == "" {
+		t.Errorf("Unexpected item, got %+v", item)
+	}
+}
+
+func TestWorkerRetry(t *testing.T) {
+	w, q, tg, source := newTestWorker(t, WithWorkers(1))
+	tg.FloodWait(2, 0)
+
+	enqueued, _ := q.Enqueue(source)
+	drain(t, w)
+
+	item, _ := q.Get(enqueued.ID)
+	if item.Status != StatusDone || item.Attempts != 3 || item.Error != "" {
+		t.Errorf("Unexpected item, got %+v", item)
+	}
+}
+
+func TestWorkerMaxAttempts(t *testing.T) {
+	w, q, tg, source := newTestWorker(t, WithWorkers(1), WithMaxAttempts(2))
+	tg.FloodWait(5, 0)
+
+	enqueued, _ := q.Enqueue(source)
+	drain(t, w)
+
+	item, _ := q.Get(enqueued.ID)
+	if item.Status != StatusFailed || item.Attempts != 2 {
+		t.Errorf("Unexpected item, got %+v", item)
+	}
+}
+
+func TestWorkerDelay(t *testing.T) {
+	w := NewWorker(nil, nil, WithBackoff(time.Second, 5*time.Second))
+	tests := []struct {
+		attempts int
+		err      error
+		delay    time.Duration
+	}{
+		{1, nil, time.Second},
+		{2, nil, 2 * time.Second},
+		{3, nil, 4 * time.Second},
+		{4, nil, 5 * time.Second},
+		{1, &ph.ErrFloodWait{RetryAfter: time.Minute}, time.Minute},
+	}
+	for _, test := range tests {
+		if delay := w.delay(test.attempts, test.err); delay != test.delay {
+			t.Errorf("Unexpected delay of attempt %d, got %s instead of %s", test.attempts, delay, test.delay)
+		}
+	}
+}
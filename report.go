@@ -0,0 +1,74 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Report is the JSON form of archiving a URL, shared by the server and the JSON
+// output of the command.
+type Report struct {
+	Source  string           `json:"source"`
+	URLs    []string         `json:"urls"`
+	Title   string           `json:"title,omitempty"`
+	Images  []string         `json:"images"`
+	Timings map[string]int64 `json:"timings_ms"`
+	Error   *ReportError     `json:"error,omitempty"`
+}
+
+// ReportError is the JSON form of an error, Type names the failed stage, e.g. "screenshot".
+type ReportError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// NewReport converts the outcome of Archiver.Archive, res may be nil.
+func NewReport(source string, res *Result, err error) Report {
+	r := Report{Source: source, URLs: []string{}, Images: []string{}, Timings: map[string]int64{}}
+	if res != nil {
+		if res.URLs != nil {
+			r.URLs = res.URLs
+		}
+		if res.Images != nil {
+			r.Images = res.Images
+		}
+		r.Title = res.Title
+		for stage, d := range res.Timings {
+			r.Timings[stage] = d.Milliseconds()
+		}
+	}
+	if err != nil {
+		r.Error = &ReportError{Type: ErrorType(err), Message: err.Error()}
+	}
+	return r
+}
+
+// Done reports whether the URL was archived.
+func (r Report) Done() bool {
+	return r.Error == nil && len(r.URLs) > 0
+}
+
+// ErrorType names the stage the error was reported from, or returns "error" if unknown.
+func ErrorType(err error) string {
+	stages := []struct {
+		err  error
+		name string
+	}{
+		{ErrAccount, "account"},
+		{ErrScreenshot, "screenshot"},
+		{ErrCapture, "capture"},
+		{ErrReadability, "readability"},
+		{ErrUpload, "upload"},
+		{ErrCreatePage, "create_page"},
+		{ErrEditPage, "edit_page"},
+	}
+	for _, stage := range stages {
+		if errors.Is(err, stage.err) {
+			return stage.name
+		}
+	}
+	return "error"
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewReport(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *Result
+		err  error
+		json string
+		done bool
+	}{
+		{
+			name: "done",
+			res:  &Result{URLs: []string{"https://telegra.ph/A"}, Title: "A", Timings: map[string]time.Duration{StagePublish: 1500 * time.Microsecond}},
+			json: `{"source":"https://example.org","urls":["https://telegra.ph/A"],"title":"A","images":[],"timings_ms":{"publish":1}}`,
+			done: true,
+		},
+		{
+			name: "failed stage",
+			err:  newError(ErrScreenshot, "https://example.org", errors.New("timeout")),
+			json: `{"source":"https://example.org","urls":[],"images":[],"timings_ms":{},"error":{"type":"screenshot","message":"https://example.org: screenshot failed: timeout"}}`,
+		},
+		{
+			name: "unknown error",
+			err:  errors.New("invalid URL"),
+			json: `{"source":"https://example.org","urls":[],"images":[],"timings_ms":{},"error":{"type":"error","message":"invalid URL"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewReport("https://example.org", test.res, test.err)
+			buf, _ := json.Marshal(r)
+			if string(buf) != test.json {
+				t.Errorf("Unexpected report, got %s instead of %s", buf, test.json)
+			}
+			if r.Done() != test.done {
+				t.Errorf("Unexpected done, got %t instead of %t", r.Done(), test.done)
+			}
+		})
+	}
+}
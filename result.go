@@ -0,0 +1,106 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stage names of Result timings.
+const (
+	StageAccount     = "account"
+	StageScreenshot  = "screenshot"
+	StageCapture     = "capture"
+	StageReadability = "readability"
+	StageUpload      = "upload"
+	StagePublish     = "publish"
+)
+
+// Result describes a webpage saved by Archive.
+type Result struct {
+	// Source is the input URL.
+	Source string
+
+	// URLs are the URLs of the published pages, in order.
+	URLs []string
+
+	// Title is the page title.
+	Title string
+
+	// Images are the URLs of the uploaded screenshots and transferred images.
+	Images []string
+
+	// Timings are the time spent in each stage, keyed by stage name, e.g. StageScreenshot.
+	Timings map[string]time.Duration
+
+	mu sync.Mutex
+}
+
+// track starts timing the stage, the returned func stops it. Time of repeated
+// stages adds up.
+func (r *Result) track(stage string) func() {
+	if r == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.Timings == nil {
+			r.Timings = make(map[string]time.Duration)
+		}
+		r.Timings[stage] += time.Since(start)
+	}
+}
+
+func (r *Result) addImages(images ...string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Images = append(r.Images, images...)
+}
+
+type ctxKeyResult struct{}
+
+func resultFromContext(ctx context.Context) *Result {
+	r, _ := ctx.Value(ctxKeyResult{}).(*Result)
+	return r
+}
+
+// Archive saves the webpage to telegra.ph like WaybackAll, and reports what was
+// published along with the time spent in each stage. The result is returned on
+// failure as well, filled up to the failed stage.
+func (arc *Archiver) Archive(ctx context.Context, input *url.URL) (*Result, error) {
+	res := &Result{Source: input.String()}
+	ctx = context.WithValue(ctx, ctxKeyResult{}, res)
+
+	done := res.track(StageAccount)
+	_, err := arc.dial(ctx)
+	done()
+	if err != nil {
+		return res, newError(ErrAccount, input.String(), err)
+	}
+
+	dirname, err := os.MkdirTemp(arc.tmpdir(), "telegraph")
+	if err != nil {
+		return res, err
+	}
+	defer os.RemoveAll(dirname)
+
+	doc, err := arc.document(ctx, input, dirname)
+	if err != nil {
+		return res, err
+	}
+	res.Title = doc.Title
+
+	res.URLs, err = arc.postDocument(ctx, doc, nil)
+	return res, err
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	ts := httptest.NewServer(writeHTML(articleHTML))
+	defer ts.Close()
+
+	arc, srv := newTestArchiver(t)
+	input, _ := url.Parse(ts.URL)
+	ctx := arc.WithMode(context.Background(), ModeArticle)
+	res, err := arc.Archive(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Source != ts.URL {
+		t.Errorf("Unexpected source, got %s instead of %s", res.Source, ts.URL)
+	}
+	if res.Title != "Archiving the Web" {
+		t.Errorf("Unexpected title, got %q instead of %q", res.Title, "Archiving the Web")
+	}
+	pages := srv.Pages()
+	if len(res.URLs) != 1 || len(pages) != 1 || res.URLs[0] != pages[0].URL {
+		t.Fatalf("Unexpected pages, got %v", res.URLs)
+	}
+	if page, ok := srv.Page(pages[0].Path); !ok || page.Title != res.Title {
+		t.Errorf("Unexpected page, got %+v", page)
+	}
+	for _, stage := range []string{StageAccount, StageCapture, StageReadability, StageUpload, StagePublish} {
+		if _, ok := res.Timings[stage]; !ok {
+			t.Errorf("Unexpected timings, %s not found in %v", stage, res.Timings)
+		}
+	}
+	if _, ok := res.Timings[StageScreenshot]; ok {
+		t.Errorf("Unexpected timings, screenshot found in article mode")
+	}
+}
+
+func TestArchiveFailure(t *testing.T) {
+	ts := httptest.NewServer(writeHTML(`<html><body></body></html>`))
+	defer ts.Close()
+
+	arc, srv := newTestArchiver(t)
+	input, _ := url.Parse(ts.URL)
+	ctx := arc.WithMode(context.Background(), ModeArticle)
+	res, err := arc.Archive(ctx, input)
+	if !errors.Is(err, ErrReadability) {
+		t.Fatalf("Unexpected error, got %v instead of %v", err, ErrReadability)
+	}
+	if res == nil || len(res.URLs) != 0 || len(srv.Pages()) != 0 {
+		t.Fatalf("Unexpected result, got %+v", res)
+	}
+	if _, ok := res.Timings[StageReadability]; !ok {
+		t.Errorf("Unexpected timings, readability not found in %v", res.Timings)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how Telegraph calls, image downloads and uploads are retried on
+// transient failures: network errors, 5xx responses and Telegraph flood control.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt, 0 disables retrying.
+	MaxRetries uint64
+
+	// InitialInterval is the first backoff interval, it grows exponentially.
+	InitialInterval time.Duration
+
+	// MaxElapsedTime bounds the time spent on all attempts, 0 means no limit.
+	MaxElapsedTime time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used unless another one is set.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:      maxRetries,
+	InitialInterval: backoff.DefaultInitialInterval,
+	MaxElapsedTime:  maxElapsedTime,
+}
+
+// WithRetryPolicy sets the retry policy of network calls.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(arc *Archiver) {
+		arc.retry = &policy
+	}
+}
+
+func (arc *Archiver) retryPolicy() RetryPolicy {
+	if arc.retry != nil {
+		return *arc.retry
+	}
+	return DefaultRetryPolicy
+}
+
+// statusError is an unexpected HTTP response status.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.status)
+}
+
+func newStatusError(resp *http.Response) error {
+	return &statusError{code: resp.StatusCode, status: resp.Status}
+}
+
+// floodWait returns the wait required by a Telegraph FLOOD_WAIT_x error.
+func floodWait(err error) (time.Duration, bool) {
+	var fw *ErrFloodWait
+	if !errors.As(err, &fw) {
+		return 0, false
+	}
+	return fw.RetryAfter, true
+}
+
+// retryable reports whether err is a transient failure worth another attempt.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if _, ok := floodWait(err); ok {
+		return true
+	}
+
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= http.StatusInternalServerError || se.code == http.StatusTooManyRequests
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// doRetry calls op until it succeeds, fails permanently, or the policy gives up. The wait
+// of a Telegraph flood control error is honoured, the number of attempts is added to the
+// returned error if more than one.
+func doRetry(ctx context.Context, policy RetryPolicy, log Logger, op func() error) error {
+	exp := backoff.NewExponentialBackOff()
+	if policy.InitialInterval > 0 {
+		exp.InitialInterval = policy.InitialInterval
+	}
+	exp.MaxElapsedTime = policy.MaxElapsedTime
+	bo := backoff.WithMaxRetries(exp, policy.MaxRetries)
+	bo.Reset()
+
+	attempts := 0
+	for {
+		attempts++
+		err := op()
+		if err == nil {
+			return nil
+		}
+
+		next := bo.NextBackOff()
+		if !retryable(err) || next == backoff.Stop {
+			if attempts > 1 {
+				return errors.Wrapf(err, "after %d attempts", attempts)
+			}
+			return err
+		}
+		if wait, ok := floodWait(err); ok && wait > next {
+			next = wait
+		}
+		orDefault(log).Debug("[telegraph] attempt %d failed: %v, retry in %s", attempts, err, next)
+
+		timer := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrapf(ctx.Err(), "after %d attempts, last error: %v", attempts, err)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{MaxRetries: 3, InitialInterval: time.Millisecond}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&apiError{method: "createPage", message: "FLOOD_WAIT_3"}, true},
+		{&apiError{method: "createPage", message: "TITLE_INVALID"}, false},
+		{&statusError{code: http.StatusBadGateway}, true},
+		{&statusError{code: http.StatusTooManyRequests}, true},
+		{&statusError{code: http.StatusNotFound}, false},
+		{&url.Error{Op: "Get", URL: "http://example.org", Err: &timeoutError{}}, true},
+		{context.Canceled, false},
+	}
+
+	for _, test := range tests {
+		if got := retryable(test.err); got != test.want {
+			t.Errorf("Unexpected retryable of %v, got %t instead of %t", test.err, got, test.want)
+		}
+	}
+
+	if wait, ok := floodWait(&apiError{message: "FLOOD_WAIT_3"}); !ok || wait != 3*time.Second {
+		t.Errorf("Unexpected flood wait, got %s", wait)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// nolint:errcheck
+func TestRetryTelegraphCall(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			io.WriteString(w, `{"ok":false,"error":"FLOOD_WAIT_0"}`)
+		default:
+			io.WriteString(w, `{"ok":true,"result":{"short_name":"wabarc","access_token":"token"}}`)
+		}
+	}))
+	defer ts.Close()
+
+	client := newAPI(ts.Client(), "", testRetryPolicy, nil)
+	client.endpoint = ts.URL
+	account, err := client.createAccount(context.Background(), "wabarc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.AccessToken != "token" || calls != 3 {
+		t.Errorf("Unexpected account %#v after %d calls", account, calls)
+	}
+}
+
+// nolint:errcheck
+func TestRetryPermanentFailure(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		io.WriteString(w, `{"ok":false,"error":"TITLE_INVALID"}`)
+	}))
+	defer ts.Close()
+
+	client := newAPI(ts.Client(), "", testRetryPolicy, nil)
+	client.endpoint = ts.URL
+	if _, err := client.createPage(context.Background(), "", nil, nil); err == nil {
+		t.Fatal("Unexpected create page with invalid title")
+	}
+	if calls != 1 {
+		t.Errorf("Unexpected calls, got %d instead of 1", calls)
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	err := doRetry(context.Background(), testRetryPolicy, nil, func() error {
+		return &statusError{code: http.StatusServiceUnavailable, status: "503 Service Unavailable"}
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "after 4 attempts") {
+		t.Errorf("Unexpected error, got %v", err)
+	}
+}
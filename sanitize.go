@@ -0,0 +1,253 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"strings"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+var (
+	// allowedTags are the tags accepted by the Telegraph API.
+	allowedTags = map[string]bool{
+		"a": true, "aside": true, "b": true, "blockquote": true, "br": true, "code": true,
+		"em": true, "figcaption": true, "figure": true, "h3": true, "h4": true, "hr": true,
+		"i": true, "iframe": true, "img": true, "li": true, "ol": true, "p": true, "pre": true,
+		"s": true, "strong": true, "u": true, "ul": true, "video": true,
+	}
+
+	// renamedTags maps unsupported tags to their closest supported equivalents.
+	renamedTags = map[string]string{
+		"h1": "h3", "h2": "h3", "h5": "h4", "h6": "h4",
+		"del": "s", "strike": "s", "ins": "u",
+		"kbd": "code", "samp": "code", "tt": "code",
+		"cite": "i", "dfn": "i", "var": "i", "mark": "b",
+		"dl": "ul", "dt": "li", "dd": "li",
+	}
+
+	// droppedTags are removed together with their content.
+	droppedTags = map[string]bool{
+		"script": true, "style": true, "noscript": true, "template": true,
+		"head": true, "meta": true, "link": true, "title": true,
+		"button": true, "input": true, "select": true, "option": true, "textarea": true,
+		"canvas": true, "object": true, "embed": true, "svg": true, "math": true,
+		"map": true, "area": true, "audio": true, "source": true, "track": true,
+	}
+
+	// inlineTags may only contain text and other inline elements.
+	inlineTags = map[string]bool{
+		"a": true, "b": true, "code": true, "em": true, "i": true,
+		"s": true, "strong": true, "u": true,
+	}
+
+	// voidTags are kept without children.
+	voidTags = map[string]bool{
+		"br": true, "hr": true, "img": true, "iframe": true, "video": true,
+	}
+)
+
+// sanitize rewrites nodes to the subset accepted by Telegraph: unsupported tags are mapped
+// to supported ones or unwrapped, attributes other than href and src are dropped, and block
+// elements nested in inline ones are unwrapped.
+func sanitize(nodes []telegraph.Node) []telegraph.Node {
+	var out []telegraph.Node
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case string:
+			if n != "" {
+				out = append(out, n)
+			}
+		case telegraph.NodeElement:
+			out = append(out, sanitizeElement(n)...)
+		}
+	}
+
+	return out
+}
+
+func sanitizeElement(n telegraph.NodeElement) []telegraph.Node {
+	tag := strings.ToLower(n.Tag)
+	// Namespaced tags, e.g. svg.path
+	if strings.Contains(tag, ".") || droppedTags[tag] {
+		return nil
+	}
+	if tag == "table" {
+		text := flattenTable(n)
+		if text == "" {
+			return nil
+		}
+		return []telegraph.Node{telegraph.NodeElement{Tag: "pre", Children: []telegraph.Node{text}}}
+	}
+	if renamed, ok := renamedTags[tag]; ok {
+		tag = renamed
+	}
+
+	children := sanitize(n.Children)
+	if !allowedTags[tag] {
+		return children
+	}
+
+	attrs := sanitizeAttrs(tag, n.Attrs)
+	switch {
+	case (tag == "img" || tag == "iframe" || tag == "video") && attrs["src"] == "":
+		return nil
+	case tag == "a" && attrs["href"] == "":
+		return children
+	case voidTags[tag]:
+		if tag == "br" || tag == "hr" || tag == "img" {
+			children = nil
+		}
+		return []telegraph.Node{telegraph.NodeElement{Tag: tag, Attrs: attrs, Children: children}}
+	case inlineTags[tag]:
+		children = unwrapBlocks(children)
+		// Collapse directly nested identical tags, e.g. <b><b>text</b></b>
+		if len(children) == 1 {
+			if child, ok := children[0].(telegraph.NodeElement); ok && child.Tag == tag && len(child.Attrs) == 0 {
+				children = child.Children
+			}
+		}
+	case tag == "p":
+		children = unwrapTag(children, "p")
+	}
+	if len(children) == 0 {
+		return nil
+	}
+
+	return []telegraph.Node{telegraph.NodeElement{Tag: tag, Attrs: attrs, Children: children}}
+}
+
+// sanitizeAttrs keeps the href and src attributes only, the lazy-loading data-src
+// of images is taken as src.
+func sanitizeAttrs(tag string, attrs map[string]string) map[string]string {
+	out := map[string]string{}
+	switch tag {
+	case "a":
+		href := strings.TrimSpace(attrs["href"])
+		if href != "" && !strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			out["href"] = href
+		}
+	case "img", "iframe", "video":
+		src := strings.TrimSpace(attrs["src"])
+		if tag == "img" && (src == "" || strings.HasPrefix(src, "data:")) && attrs["data-src"] != "" {
+			src = strings.TrimSpace(attrs["data-src"])
+		}
+		if src != "" {
+			out["src"] = src
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+
+	return out
+}
+
+// unwrapBlocks replaces block elements in nodes with their children.
+func unwrapBlocks(nodes []telegraph.Node) []telegraph.Node {
+	var out []telegraph.Node
+	for _, node := range nodes {
+		if element, ok := node.(telegraph.NodeElement); ok && !isInline(element) {
+			out = append(out, unwrapBlocks(element.Children)...)
+			continue
+		}
+		out = append(out, node)
+	}
+
+	return out
+}
+
+// unwrapTag replaces elements of tag in nodes with their children.
+func unwrapTag(nodes []telegraph.Node, tag string) []telegraph.Node {
+	var out []telegraph.Node
+	for _, node := range nodes {
+		if element, ok := node.(telegraph.NodeElement); ok && element.Tag == tag {
+			out = append(out, element.Children...)
+			continue
+		}
+		out = append(out, node)
+	}
+
+	return out
+}
+
+func isInline(element telegraph.NodeElement) bool {
+	return inlineTags[element.Tag] || element.Tag == "br" || element.Tag == "img"
+}
+
+// blockify wraps runs of top-level text and inline elements in paragraphs.
+func blockify(nodes []telegraph.Node) []telegraph.Node {
+	var out []telegraph.Node
+	var run []telegraph.Node
+	flush := func() {
+		if len(run) > 0 {
+			out = append(out, telegraph.NodeElement{Tag: "p", Children: run})
+		}
+		run = nil
+	}
+
+	for _, node := range nodes {
+		if element, ok := node.(telegraph.NodeElement); ok && !isInline(element) {
+			flush()
+			out = append(out, node)
+			continue
+		}
+		run = append(run, node)
+	}
+	flush()
+
+	return out
+}
+
+// flattenTable renders the table as text, a row per line with cells separated by " | ".
+func flattenTable(table telegraph.NodeElement) string {
+	var rows []string
+	var walk func(nodes []telegraph.Node)
+	walk = func(nodes []telegraph.Node) {
+		for _, node := range nodes {
+			element, ok := node.(telegraph.NodeElement)
+			if !ok {
+				continue
+			}
+			if strings.ToLower(element.Tag) != "tr" {
+				walk(element.Children)
+				continue
+			}
+			var cells []string
+			for _, cell := range element.Children {
+				if c, ok := cell.(telegraph.NodeElement); ok {
+					cells = append(cells, textOf(c.Children))
+				}
+			}
+			rows = append(rows, strings.Join(cells, " | "))
+		}
+	}
+	walk(table.Children)
+
+	if len(rows) == 0 {
+		return textOf(table.Children)
+	}
+	return strings.Join(rows, "\n")
+}
+
+// textOf returns the text content of nodes with whitespace collapsed.
+func textOf(nodes []telegraph.Node) string {
+	var sb strings.Builder
+	var walk func(nodes []telegraph.Node)
+	walk = func(nodes []telegraph.Node) {
+		for _, node := range nodes {
+			switch n := node.(type) {
+			case string:
+				sb.WriteString(n)
+				sb.WriteString(" ")
+			case telegraph.NodeElement:
+				walk(n.Children)
+			}
+		}
+	}
+	walk(nodes)
+
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
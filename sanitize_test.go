@@ -0,0 +1,70 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "headings",
+			html: `<h1 class="title">Title</h1><h2>Sub</h2><h5>Minor</h5>`,
+			want: `[{"tag":"h3","children":["Title"]},{"tag":"h3","children":["Sub"]},{"tag":"h4","children":["Minor"]}]`,
+		},
+		{
+			name: "unwrap",
+			html: `<div><section><p style="color:red" onclick="x()">text</p></section></div>`,
+			want: `[{"tag":"p","children":["text"]}]`,
+		},
+		{
+			name: "dropped",
+			html: `<p>text</p><script>alert(1)</script><svg><path d="M0"></path></svg>`,
+			want: `[{"tag":"p","children":["text"]}]`,
+		},
+		{
+			name: "attributes",
+			html: `<p><a href="https://example.org/" target="_blank" class="link">link</a><a href="javascript:void(0)">js</a></p><img data-src="https://example.org/lazy.png" src="data:image/gif;base64,R0lGOD" srcset="x 2x">`,
+			want: `[{"tag":"p","children":[{"tag":"a","attrs":{"href":"https://example.org/"},"children":["link"]},"js"]},{"tag":"p","children":[{"tag":"img","attrs":{"src":"https://example.org/lazy.png"}}]}]`,
+		},
+		{
+			name: "inline",
+			html: `<div><b><b>bold</b></b><em><h1>block</h1></em></div>`,
+			want: `[{"tag":"p","children":[{"tag":"b","children":["bold"]},{"tag":"em","children":["block"]}]}]`,
+		},
+		{
+			name: "table",
+			html: `<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>`,
+			want: `[{"tag":"pre","children":["a | b\n1 | 2"]}]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(test.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			arc := &Archiver{}
+			nodes := blockify(sanitize(castNodes(arc.traverseNodes(doc.Contents()))))
+			got, err := json.Marshal(nodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Unexpected sanitized nodes,\n got: %s\nwant: %s", got, test.want)
+			}
+		})
+	}
+}
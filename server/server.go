@@ -0,0 +1,389 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package server exposes an archiver as a REST API, so that services share a single
+archiver with its account, image cache and concurrency limits.
+
+	POST /archive    archive a webpage, {"url": "...", "mode": "article", "async": true}
+	GET  /jobs/{id}  status of an asynchronous archive
+	POST /publish    publish content, {"title": "...", "html": "..."} or {"markdown": "..."}
+	GET  /healthz    health check
+
+Synchronous archives respond with the result, asynchronous ones respond with a job
+to poll. Server is an http.Handler:
+
+	srv := server.New(ph.New())
+	defer srv.Close()
+
+	http.ListenAndServe(":8080", srv)
+*/
+package server // import "github.com/wabarc/telegra.ph/server"
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wabarc/telegra.ph"
+)
+
+const (
+	defaultWorkers = 4
+	defaultTimeout = 5 * time.Minute
+	defaultJobTTL  = time.Hour
+	maxBodySize    = 10 << 20
+
+	// maxMarkdownSize caps the Markdown of a publish request, it bounds the parse time.
+	maxMarkdownSize = 1 << 20
+)
+
+// Job states.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Job is an asynchronous archive.
+type Job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	URL      string     `json:"url"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Result   *ph.Report `json:"result,omitempty"`
+
+	mode ph.Mode
+}
+
+// Server serves the archiver over HTTP, asynchronous archives are run by a pool of
+// workers until Close.
+type Server struct {
+	arc *ph.Archiver
+	mux *http.ServeMux
+
+	workers int
+	timeout time.Duration
+	jobTTL  time.Duration
+	mode    ph.Mode
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	queue  chan *Job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Option configures the Server.
+type Option func(*Server)
+
+// WithWorkers sets the number of asynchronous archives run at once, defaults to 4.
+func WithWorkers(n int) Option {
+	return func(s *Server) {
+		s.workers = n
+	}
+}
+
+// WithTimeout sets the timeout of each archive or publish, defaults to 5 minutes.
+func WithTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = d
+	}
+}
+
+// WithMode sets the mode of archives that do not ask for one, defaults to ph.ModeFull.
+func WithMode(mode ph.Mode) Option {
+	return func(s *Server) {
+		s.mode = mode
+	}
+}
+
+// WithJobTTL sets how long finished jobs are kept, defaults to an hour.
+func WithJobTTL(d time.Duration) Option {
+	return func(s *Server) {
+		s.jobTTL = d
+	}
+}
+
+// New returns a Server of the archiver and starts its workers.
+func New(arc *ph.Archiver, opts ...Option) *Server {
+	s := &Server{
+		arc:  arc,
+		mux:  http.NewServeMux(),
+		jobs: make(map[string]*Job),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.workers <= 0 {
+		s.workers = defaultWorkers
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultTimeout
+	}
+	if s.jobTTL <= 0 {
+		s.jobTTL = defaultJobTTL
+	}
+
+	s.mux.HandleFunc("/archive", s.handleArchive)
+	s.mux.HandleFunc("/jobs/", s.handleJob)
+	s.mux.HandleFunc("/publish", s.handlePublish)
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.queue = make(chan *Job, 1024)
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close cancels the running jobs and stops the workers.
+func (s *Server) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Server) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case job := <-s.queue:
+			s.run(job)
+		}
+	}
+}
+
+func (s *Server) run(job *Job) {
+	s.setStatus(job, StatusRunning, nil)
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
+	defer cancel()
+
+	r := s.archive(ctx, job.URL, job.mode)
+	status := StatusDone
+	if r.Error != nil {
+		status = StatusFailed
+	}
+	s.setStatus(job, status, &r)
+}
+
+func (s *Server) setStatus(job *Job, status string, r *ph.Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.Status = status
+	if r != nil {
+		now := time.Now()
+		job.Result = r
+		job.Finished = &now
+	}
+}
+
+func (s *Server) archive(ctx context.Context, link string, mode ph.Mode) ph.Report {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ph.NewReport(link, nil, err)
+	}
+	res, err := s.arc.Archive(s.arc.WithMode(ctx, mode), u)
+	return ph.NewReport(link, res, err)
+}
+
+type archiveRequest struct {
+	URL   string `json:"url"`
+	Mode  string `json:"mode"`
+	Async bool   `json:"async"`
+}
+
+func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var req archiveRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, http.StatusBadRequest, errors.New("invalid url"))
+		return
+	}
+	mode := s.mode
+	if req.Mode != "" {
+		if mode, err = ph.ParseMode(req.Mode); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if !req.Async {
+		ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+		defer cancel()
+
+		res := s.archive(ctx, req.URL, mode)
+		status := http.StatusOK
+		if res.Error != nil {
+			status = http.StatusBadGateway
+		}
+		writeJSON(w, status, res)
+		return
+	}
+
+	job := &Job{ID: newID(), Status: StatusQueued, URL: req.URL, Created: time.Now(), mode: mode}
+	s.mu.Lock()
+	s.prune()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- job:
+	default:
+		s.mu.Lock()
+		delete(s.jobs, job.ID)
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, errors.New("queue full"))
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, s.snapshot(job))
+}
+
+// prune removes the jobs finished longer than the TTL ago, s.mu must be held.
+func (s *Server) prune() {
+	for id, job := range s.jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > s.jobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *Server) snapshot(job *Job) Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *job
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.snapshot(job))
+}
+
+type publishRequest struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	HTML     string `json:"html"`
+	Markdown string `json:"markdown"`
+}
+
+type publishResponse struct {
+	URLs  []string        `json:"urls"`
+	Error *ph.ReportError `json:"error,omitempty"`
+}
+
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var req publishRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(req.Markdown) > maxMarkdownSize {
+		writeError(w, http.StatusRequestEntityTooLarge, errors.New("markdown too large"))
+		return
+	}
+
+	doc := ph.Document{Title: req.Title, URL: req.URL, HTML: req.HTML}
+	if req.Markdown != "" {
+		title, nodes := ph.ParseMarkdown([]byte(req.Markdown))
+		if doc.Title == "" {
+			doc.Title = title
+		}
+		doc.Nodes = nodes
+	}
+	if strings.TrimSpace(doc.Title) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("title required"))
+		return
+	}
+	if len(doc.Nodes) == 0 && strings.TrimSpace(doc.HTML) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("html or markdown required"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	dsts, err := s.arc.Publish(ctx, doc)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, publishResponse{URLs: []string{}, Error: &ph.ReportError{Type: ph.ErrorType(err), Message: err.Error()}})
+		return
+	}
+	writeJSON(w, http.StatusOK, publishResponse{URLs: dsts})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func decode(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errors.New("invalid request body: " + err.Error())
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v) // nolint:errcheck
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error *ph.ReportError `json:"error"`
+	}{&ph.ReportError{Type: "request", Message: err.Error()}})
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b) // nolint:errcheck
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package server // import "github.com/wabarc/telegra.ph/server"
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/telegra.ph"
+	"github.com/wabarc/telegra.ph/phtest"
+)
+
+const articleHTML = `<html><head><title>Archiving the Web</title></head><body>
+<article><h1>Archiving the Web</h1>
+<p>Web archiving is the process of collecting portions of the World Wide Web to ensure the information is preserved in an archive for future researchers, historians, and the public.</p>
+<p>Web archivists typically employ web crawlers for automated capture due to the massive size and amount of information on the Web. The largest web archiving organization based on a bulk crawling approach is the Wayback Machine.</p>
+</article></body></html>`
+
+func newTestServer(t *testing.T) (*httptest.Server, *phtest.Server, string) {
+	tg := phtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, articleHTML) // nolint:errcheck
+	}))
+	t.Cleanup(source.Close)
+
+	arc := ph.New(
+		ph.WithBaseURL(tg.URL),
+		ph.WithImageUploaders(&ph.TelegraphUploader{Endpoint: tg.UploadURL()}),
+		ph.WithRetryPolicy(ph.RetryPolicy{}),
+	)
+	srv := New(arc, WithTimeout(30*time.Second))
+	ts := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Close()
+	})
+
+	return ts, tg, source.URL
+}
+
+func post(t *testing.T, url, body string, v interface{}) *http.Response {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func TestHealthz(t *testing.T) {
+	ts, _, _ := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected status, got %d instead of %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestArchiveSync(t *testing.T) {
+	ts, tg, source := newTestServer(t)
+
+	var res ph.Report
+	resp := post(t, ts.URL+"/archive", `{"url":"`+source+`","mode":"article"}`, &res)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status, got %d instead of %d: %+v", resp.StatusCode, http.StatusOK, res.Error)
+	}
+	if res.Title != "Archiving the Web" || len(res.URLs) != 1 || !res.Done() {
+		t.Errorf("Unexpected result, got %+v", res)
+	}
+	if len(tg.Pages()) != 1 {
+		t.Errorf("Unexpected pages, got %d instead of 1", len(tg.Pages()))
+	}
+}
+
+func TestArchiveAsync(t *testing.T) {
+	ts, _, source := newTestServer(t)
+
+	var job Job
+	resp := post(t, ts.URL+"/archive", `{"url":"`+source+`","mode":"article","async":true}`, &job)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Unexpected status, got %d instead of %d", resp.StatusCode, http.StatusAccepted)
+	}
+	if loc := resp.Header.Get("Location"); loc != "/jobs/"+job.ID {
+		t.Errorf("Unexpected location, got %s instead of /jobs/%s", loc, job.ID)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for job.Status != StatusDone && job.Status != StatusFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("Unexpected status, got %s after 10s", job.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+		resp, err := http.Get(ts.URL + "/jobs/" + job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(&job) // nolint:errcheck
+		resp.Body.Close()
+	}
+	if job.Status != StatusDone || job.Result == nil || len(job.Result.URLs) != 1 {
+		t.Errorf("Unexpected job, got %+v", job)
+	}
+
+	resp, err := http.Get(ts.URL + "/jobs/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unexpected status, got %d instead of %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestArchiveInvalid(t *testing.T) {
+	ts, _, _ := newTestServer(t)
+
+	tests := []string{
+		`{"url":"ftp://example.org/"}`,
+		`{"url":"https://example.org/","mode":"pdf"}`,
+		`{"link":"https://example.org/"}`,
+		`not json`,
+	}
+	for _, body := range tests {
+		if resp := post(t, ts.URL+"/archive", body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Unexpected status of %s, got %d instead of %d", body, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status, got %d instead of %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ts, tg, _ := newTestServer(t)
+
+	var out publishResponse
+	resp := post(t, ts.URL+"/publish", `{"markdown":"# Changelog\n\n- Add server mode\n"}`, &out)
+	if resp.StatusCode != http.StatusOK || len(out.URLs) != 1 {
+		t.Fatalf("Unexpected response, got %d %+v", resp.StatusCode, out)
+	}
+	path := out.URLs[0][strings.LastIndex(out.URLs[0], "/")+1:]
+	if page, ok := tg.Page(path); !ok || page.Title != "Changelog" {
+		t.Errorf("Unexpected page, got %+v", page)
+	}
+
+	resp = post(t, ts.URL+"/publish", `{"title":"Hello","html":"<p>Hello, World</p>"}`, &out)
+	if resp.StatusCode != http.StatusOK || len(out.URLs) != 1 {
+		t.Errorf("Unexpected response, got %d %+v", resp.StatusCode, out)
+	}
+
+	if resp := post(t, ts.URL+"/publish", `{"title":"Empty"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected status, got %d instead of %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	body := `{"title":"Large","markdown":"` + strings.Repeat("a", maxMarkdownSize+1) + `"}`
+	if resp := post(t, ts.URL+"/publish", body, nil); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected status, got %d instead of %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/kallydev/telegraph-go"
+	"github.com/pkg/errors"
+	"github.com/wabarc/helper"
+)
+
+// ctxTransport binds every request sent through it to ctx.
+type ctxTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// transferImages transfers the media referenced by img and video elements of sanitized nodes
+// concurrently, and rewrites the attributes to the transferred URLs. It returns when all
+// transfers have finished or been cancelled by ctx.
+func (arc *Archiver) transferImages(ctx context.Context, nodes []telegraph.Node) []telegraph.Node {
+	type job struct {
+		attrs  map[string]string
+		key    string
+		newurl string
+	}
+
+	var jobs []*job
+	var walk func(nodes []telegraph.Node)
+	walk = func(nodes []telegraph.Node) {
+		for _, node := range nodes {
+			element, ok := node.(telegraph.NodeElement)
+			if !ok {
+				continue
+			}
+			// Upload image or video to telegra.ph or ImgBB
+			if (element.Tag == "img" || element.Tag == "video") && element.Attrs["src"] != "" {
+				jobs = append(jobs, &job{attrs: element.Attrs, key: "src"})
+			}
+			walk(element.Children)
+		}
+	}
+	walk(nodes)
+
+	workers := arc.concurrency
+	if workers <= 0 {
+		workers = defaultConcurrency
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	queue := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				src := j.attrs[j.key]
+				arc.logger().Debug("transferring url: %s", src)
+				j.newurl = arc.transferImage(ctx, src)
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	// Assign transferred URI
+	res := resultFromContext(ctx)
+	for _, j := range jobs {
+		if j.newurl != "" {
+			arc.logger().Debug("new url: %s", j.newurl)
+			j.attrs[j.key] = j.newurl
+			res.addImages(j.newurl)
+		}
+	}
+
+	return nodes
+}
+
+func (arc *Archiver) download(ctx context.Context, u *url.URL) (path string, err error) {
+	if !helper.IsURL(u.String()) {
+		return path, errors.New("invalid url")
+	}
+
+	release, err := arc.limiter().acquireHost(ctx, u.Host)
+	if err != nil {
+		return path, err
+	}
+	defer release()
+
+	path = filepath.Join(arc.tmpdir(), helper.RandString(21, "lower"))
+	err = doRetry(ctx, arc.retryPolicy(), arc.logger(), func() error {
+		return arc.fetch(ctx, u, path)
+	})
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// fetch writes the response body of u to the file at path.
+func (arc *Archiver) fetch(ctx context.Context, u *url.URL, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient(arc.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return newStatusError(resp)
+	}
+
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	_, err = io.Copy(fd, resp.Body)
+	return err
+}
+
+// transferImage download image from original server and upload to Telegraph or ImgBB,
+// it returns full url of the uploaded image, or empty string if failed. Images already
+// transferred are taken from the cache, concurrent transfers of the same image are merged.
+func (arc *Archiver) transferImage(ctx context.Context, s string) string {
+	arc.logger().Debug("[telegraph] uri: %s", s)
+	if strings.HasPrefix(s, "data:") || ctx.Err() != nil {
+		return ""
+	}
+
+	dst, ok := arc.imageCache().Get(sourceKey(s))
+	for !ok {
+		v, err, _ := arc.flight.Do(s, func() (interface{}, error) {
+			dst := arc.transfer(ctx, s)
+			if dst == "" && ctx.Err() != nil {
+				// Failed by the context of the caller running the transfer, it is
+				// not shared with the callers merged into it.
+				return "", ctx.Err()
+			}
+			return dst, nil
+		})
+		// Transfer again if merged into a caller whose context was cancelled.
+		dst, ok = v.(string), err == nil || ctx.Err() != nil
+	}
+	// Images uploaded by the archiver itself map to their own URL.
+	if dst == "" || dst == s {
+		return ""
+	}
+
+	newurl := dst + "?orig=" + s
+	arc.logger().Debug("[telegraph] new uri: %s", newurl)
+
+	return newurl
+}
+
+func (arc *Archiver) transfer(ctx context.Context, s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		arc.logger().Error("parse uri failed: %v", err)
+		return ""
+	}
+
+	// Slots of the archiver are shared with other pages in progress.
+	release, err := arc.limiter().acquire(ctx)
+	if err != nil {
+		return ""
+	}
+	defer release()
+
+	path, err := arc.download(ctx, u)
+	if err != nil {
+		arc.logger().Error("download image failed: %v", err)
+		return ""
+	}
+	defer os.Remove(path)
+	arc.logger().Debug("[telegraph] downloaded image path: %s", path)
+
+	mtype, err := mimetype.DetectFile(path)
+	if os.IsNotExist(err) {
+		arc.logger().Error("file %s not exists", path)
+		return ""
+	}
+
+	arc.logger().Debug("[telegraph] content type: %s", mtype.String())
+	if mtype.Is("image/webp") {
+		dst := path + ".png"
+		if err := helper.WebPToPNG(path, dst); err != nil {
+			arc.logger().Error("[telegraph] convert webp failed: %v", err)
+		} else {
+			defer os.Remove(dst)
+			arc.logger().Debug("[telegraph] converted image path: %s", dst)
+			path = dst
+		}
+	}
+
+	dst, err := arc.uploadImage(ctx, path)
+	if err != nil {
+		arc.logger().Error("upload image failed: %v", err)
+		return ""
+	}
+	if err := arc.imageCache().Set(sourceKey(s), dst); err != nil {
+		arc.logger().Error("[telegraph] cache image failed: %v", err)
+	}
+
+	return dst
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kallydev/telegraph-go"
+)
+
+func TestTransferImagesCancel(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	src := ts.URL + "/image.png"
+	nodes := []telegraph.Node{
+		telegraph.NodeElement{
+			Tag: "p",
+			Children: []telegraph.Node{
+				telegraph.NodeElement{Tag: "img", Attrs: map[string]string{"src": src}},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	returned := make(chan []telegraph.Node)
+	go func() {
+		returned <- New().transferImages(ctx, nodes)
+	}()
+
+	select {
+	case nodes = <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unexpected transfer images, not return after context cancelled")
+	}
+
+	img := nodes[0].(telegraph.NodeElement).Children[0].(telegraph.NodeElement)
+	if img.Attrs["src"] != src {
+		t.Errorf("Unexpected src, got %s instead of %s", img.Attrs["src"], src)
+	}
+}
+
+// nolint:errcheck
+func TestTransferImagesVideo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom")
+	}))
+	defer ts.Close()
+
+	var mimes []string
+	arc := New(WithImageUploaders(uploaderFunc(func(_ context.Context, _ io.Reader, mime string) (string, error) {
+		mimes = append(mimes, mime)
+		return "https://telegra.ph/file/video.mp4", nil
+	})))
+
+	src := ts.URL + "/video.mp4"
+	nodes := arc.transferImages(context.Background(), []telegraph.Node{
+		telegraph.NodeElement{Tag: "figure", Children: []telegraph.Node{
+			telegraph.NodeElement{Tag: "video", Attrs: map[string]string{"src": src}},
+		}},
+		telegraph.NodeElement{Tag: "iframe", Attrs: map[string]string{"src": ts.URL + "/embed"}},
+	})
+
+	video := nodes[0].(telegraph.NodeElement).Children[0].(telegraph.NodeElement)
+	if want := "https://telegra.ph/file/video.mp4?orig=" + src; video.Attrs["src"] != want {
+		t.Errorf("Unexpected src, got %s instead of %s", video.Attrs["src"], want)
+	}
+	if len(mimes) != 1 || mimes[0] != "video/mp4" {
+		t.Errorf("Unexpected uploads, got %v instead of [video/mp4]", mimes)
+	}
+}
+
+// nolint:errcheck
+func TestTransferImageCancelMerged(t *testing.T) {
+	var requests int32
+	started := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, "image")
+	}))
+	defer ts.Close()
+
+	arc := New(WithImageUploaders(uploaderFunc(func(context.Context, io.Reader, string) (string, error) {
+		return "https://telegra.ph/file/uploaded.png", nil
+	})))
+	src := ts.URL + "/image.png"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go arc.transferImage(ctx, src)
+	<-started
+
+	merged := make(chan string)
+	go func() {
+		merged <- arc.transferImage(context.Background(), src)
+	}()
+	// Let the second transfer merge into the first before cancelling it.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case dst := <-merged:
+		if dst != "https://telegra.ph/file/uploaded.png?orig="+src {
+			t.Errorf("Unexpected transferred image, got %q", dst)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unexpected transfer image, not return after the merged transfer cancelled")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Update captures the webpage again and overwrites the existing Telegraph page with it,
+// page is the path or the URL of the page, which must belong to the account of the
+// archiver. The page keeps its URL, content that no longer fits is published to new
+// pages linked from it. It returns the URLs of the pages, the updated one first.
+//
+// The page list of the account is read before the webpage is captured, a call per 200
+// pages, so that ErrAccessDenied is returned up front for a page of another account.
+func (arc *Archiver) Update(ctx context.Context, page string, input *url.URL) ([]string, error) {
+	client, err := arc.dialExisting(ctx)
+	if err != nil {
+		return nil, newError(ErrAccount, input.String(), err)
+	}
+
+	existing, err := client.getPage(ctx, pagePath(page), false)
+	if err != nil {
+		return nil, newError(ErrEditPage, input.String(), err)
+	}
+	owned, err := owns(ctx, client, existing.Path)
+	if err != nil {
+		return nil, newError(ErrEditPage, input.String(), err)
+	}
+	if !owned {
+		return nil, newError(ErrEditPage, input.String(), ErrAccessDenied)
+	}
+
+	dirname, err := os.MkdirTemp(arc.tmpdir(), "telegraph")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dirname)
+
+	doc, err := arc.document(ctx, input, dirname)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(doc.Title) == "" {
+		doc.Title = existing.Title
+	}
+
+	return arc.postDocument(ctx, doc, existing)
+}
+
+// owns reports whether the page of path belongs to the account of the client.
+func owns(ctx context.Context, client *api, path string) (bool, error) {
+	for offset := 0; ; {
+		list, err := client.getPageList(ctx, offset, pageListLimit)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range list.Pages {
+			if p.Path == path {
+				return true, nil
+			}
+		}
+		offset += len(list.Pages)
+		if len(list.Pages) == 0 || offset >= list.TotalCount {
+			return false, nil
+		}
+	}
+}
+
+// pagePath returns the path of a Telegraph page given its path or URL.
+func pagePath(page string) string {
+	if u, err := url.Parse(page); err == nil && u.Host != "" {
+		page = u.Path
+	}
+	return strings.Trim(page, "/")
+}
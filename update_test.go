@@ -0,0 +1,111 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	ts := httptest.NewServer(writeHTML(articleHTML))
+	defer ts.Close()
+
+	arc, srv := newTestArchiver(t)
+	archived, err := arc.Publish(context.Background(), Document{Title: "Archive", HTML: "<p>Outdated</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input, _ := url.Parse(ts.URL)
+	ctx := arc.WithMode(context.Background(), ModeArticle)
+	dsts, err := arc.Update(ctx, archived[0], input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dsts) != 1 || dsts[0] != archived[0] {
+		t.Errorf("Unexpected pages, got %v instead of %v", dsts, archived)
+	}
+	if pages := srv.Pages(); len(pages) != 1 {
+		t.Errorf("Unexpected pages created, got %d instead of 1", len(pages))
+	}
+	page, _ := srv.Page(pagePath(archived[0]))
+	content, _ := json.Marshal(page.Content)
+	if !strings.Contains(string(content), "Wayback Machine") || strings.Contains(string(content), "Outdated") {
+		t.Errorf("Unexpected content, got %s", content)
+	}
+
+	_, err = arc.Update(ctx, "Missing-01-01", input)
+	if !errors.Is(err, ErrEditPage) || !errors.Is(err, ErrPageNotFound) {
+		t.Errorf("Unexpected error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), ts.URL) {
+		t.Errorf("Unexpected error, %s not found in %v", ts.URL, err)
+	}
+}
+
+func TestUpdateAccessDenied(t *testing.T) {
+	var captures int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&captures, 1)
+		writeHTML(articleHTML).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	owner, srv := newTestArchiver(t)
+	archived, err := owner.Publish(context.Background(), Document{Title: "Archive", HTML: "<p>Outdated</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edits := srv.Calls("editPage")
+
+	input, _ := url.Parse(ts.URL)
+	other := New(WithBaseURL(srv.URL), WithRetryPolicy(testRetryPolicy))
+	if _, err := other.Account(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx := other.WithMode(context.Background(), ModeArticle)
+	_, err = other.Update(ctx, archived[0], input)
+	if !errors.Is(err, ErrEditPage) || !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Unexpected error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&captures); n != 0 {
+		t.Errorf("Unexpected captures, got %d instead of 0", n)
+	}
+	if n := srv.Calls("editPage"); n != edits {
+		t.Errorf("Unexpected editPage calls, got %d instead of %d", n, edits)
+	}
+
+	_, err = New(WithBaseURL(srv.URL), WithRetryPolicy(testRetryPolicy)).Update(ctx, archived[0], input)
+	if !errors.Is(err, ErrAccount) || !errors.Is(err, ErrNoAccount) {
+		t.Errorf("Unexpected error without account, got %v", err)
+	}
+}
+
+func TestPagePath(t *testing.T) {
+	tests := []struct {
+		page string
+		path string
+	}{
+		{"Archive-01-01", "Archive-01-01"},
+		{"/Archive-01-01", "Archive-01-01"},
+		{"https://telegra.ph/Archive-01-01", "Archive-01-01"},
+		{"https://telegra.ph/Archive-01-01?title=Archive", "Archive-01-01"},
+	}
+
+	for _, test := range tests {
+		if path := pagePath(test.page); path != test.path {
+			t.Errorf("Unexpected path of %s, got %s instead of %s", test.page, path, test.path)
+		}
+	}
+}
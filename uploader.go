@@ -0,0 +1,439 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wabarc/imgbb"
+)
+
+const (
+	telegraphSite   = "https://telegra.ph"
+	telegraphUpload = telegraphSite + "/upload"
+
+	// ImgBB rejects images larger than 32 MB.
+	maxImgBBSize = 32 << 20
+)
+
+// ImageUploader uploads an image to an image host and returns its URL.
+type ImageUploader interface {
+	Upload(ctx context.Context, r io.Reader, mime string) (string, error)
+}
+
+// WithImageUploaders sets the image hosts images are uploaded to, they are
+// tried in order until one succeeds. Defaults to Telegraph then ImgBB.
+func WithImageUploaders(uploaders ...ImageUploader) Option {
+	return func(arc *Archiver) {
+		arc.uploaders = uploaders
+	}
+}
+
+// defaultUploaders returns the Telegraph uploader, at the upload URL and with the
+// HTTP client set for Telegraph, followed by ImgBB.
+func (arc *Archiver) defaultUploaders() []ImageUploader {
+	telegraph := NewTelegraphUploader(arc.telegraphClient())
+	if arc.uploadURL != "" {
+		telegraph.Endpoint = arc.uploadURL
+	}
+	return []ImageUploader{telegraph, NewImgBBUploader(arc.Client, "")}
+}
+
+// TelegraphUploader uploads images to Telegraph.
+type TelegraphUploader struct {
+	Client *http.Client
+
+	// Endpoint is the upload URL, uploaded images are served from its host.
+	Endpoint string
+}
+
+// NewTelegraphUploader returns a TelegraphUploader using the given client.
+func NewTelegraphUploader(client *http.Client) *TelegraphUploader {
+	return &TelegraphUploader{Client: client, Endpoint: telegraphUpload}
+}
+
+// Upload uploads an image to Telegraph.
+func (tu *TelegraphUploader) Upload(ctx context.Context, r io.Reader, mime string) (string, error) {
+	endpoint := tu.Endpoint
+	if endpoint == "" {
+		endpoint = telegraphUpload
+	}
+
+	body, ctype, err := multipartBody("file", mime, r, nil)
+	if err != nil {
+		return "", err
+	}
+	data, err := doUpload(ctx, tu.Client, endpoint, ctype, body, nil)
+	if err != nil {
+		return "", errors.Wrap(err, `upload image to Telegraph failed`)
+	}
+
+	var files []struct {
+		Src string `json:"src"`
+	}
+	if err := json.Unmarshal(data, &files); err != nil {
+		var res struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &res) == nil && res.Error != "" {
+			return "", errors.Errorf("upload image to Telegraph failed: %s", strings.ToLower(res.Error))
+		}
+		return "", errors.Wrap(err, `decode Telegraph response failed`)
+	}
+	if len(files) == 0 || files[0].Src == "" {
+		return "", errors.New("upload image to Telegraph failed: empty response")
+	}
+
+	return resolveURL(endpoint, files[0].Src), nil
+}
+
+// ImgBBUploader uploads images to ImgBB, anonymously if Key is empty.
+type ImgBBUploader struct {
+	Client *http.Client
+	Key    string
+}
+
+// NewImgBBUploader returns an ImgBBUploader with the given client and API key.
+func NewImgBBUploader(client *http.Client, key string) *ImgBBUploader {
+	return &ImgBBUploader{Client: client, Key: key}
+}
+
+// Upload uploads an image to ImgBB.
+func (iu *ImgBBUploader) Upload(ctx context.Context, r io.Reader, mime string) (string, error) {
+	endpoint, field := imgbb.IMGBB_URI, "source"
+	fields := map[string]string{"type": "file", "action": "upload"}
+	if iu.Key != "" {
+		endpoint, field = imgbb.IMGBB_API, "image"
+		fields = map[string]string{"key": iu.Key}
+	}
+
+	body, ctype, err := multipartBody(field, mime, io.LimitReader(r, maxImgBBSize+1), fields)
+	if err != nil {
+		return "", err
+	}
+	if body.Len() > maxImgBBSize {
+		return "", errors.Errorf("upload image to ImgBB failed: file too large")
+	}
+
+	header := http.Header{}
+	header.Set("Origin", "https://imgbb.com")
+	header.Set("Referer", "https://imgbb.com/")
+	data, err := doUpload(ctx, iu.Client, endpoint, ctype, body, header)
+	if err != nil {
+		return "", errors.Wrap(err, `upload image to ImgBB failed`)
+	}
+
+	var res struct {
+		StatusTxt string `json:"status_txt"`
+		Image     struct {
+			URL string `json:"url"`
+		} `json:"image"`
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", errors.Wrap(err, `decode ImgBB response failed`)
+	}
+	if res.Data.URL != "" {
+		return res.Data.URL, nil
+	}
+	if res.Image.URL != "" {
+		return res.Image.URL, nil
+	}
+	if res.Error.Message != "" {
+		return "", errors.Errorf("upload image to ImgBB failed: %s", res.Error.Message)
+	}
+
+	return "", errors.Errorf("upload image to ImgBB failed: %s", res.StatusTxt)
+}
+
+// MultipartUploader uploads images to a generic HTTP endpoint as multipart form data.
+type MultipartUploader struct {
+	Client *http.Client
+
+	// Endpoint is the URL the form is posted to.
+	Endpoint string
+
+	// Field is the form field of the image, defaults to "file".
+	Field string
+
+	// Fields and Header are extra form fields and request headers, e.g. credentials.
+	Fields map[string]string
+	Header http.Header
+
+	// URLField is the dot separated path to the image URL in the JSON response,
+	// e.g. "data.url". The whole response body is taken as the URL if it is empty.
+	URLField string
+}
+
+// Upload uploads an image to the endpoint.
+func (mu *MultipartUploader) Upload(ctx context.Context, r io.Reader, mime string) (string, error) {
+	field := mu.Field
+	if field == "" {
+		field = "file"
+	}
+
+	body, ctype, err := multipartBody(field, mime, r, mu.Fields)
+	if err != nil {
+		return "", err
+	}
+	data, err := doUpload(ctx, mu.Client, mu.Endpoint, ctype, body, mu.Header)
+	if err != nil {
+		return "", errors.Wrap(err, `upload image failed`)
+	}
+
+	if mu.URLField == "" {
+		return resolveURL(mu.Endpoint, strings.TrimSpace(string(data))), nil
+	}
+
+	var res interface{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", errors.Wrap(err, `decode response failed`)
+	}
+	for _, key := range strings.Split(mu.URLField, ".") {
+		m, ok := res.(map[string]interface{})
+		if !ok {
+			res = nil
+			break
+		}
+		res = m[key]
+	}
+	u, ok := res.(string)
+	if !ok || u == "" {
+		return "", errors.Errorf("image url %s not found in response", mu.URLField)
+	}
+
+	return resolveURL(mu.Endpoint, u), nil
+}
+
+// S3Uploader uploads images to an S3 compatible object storage, objects are
+// named after the SHA-256 of their content.
+type S3Uploader struct {
+	Client *http.Client
+
+	// Endpoint is the storage service URL, e.g. https://s3.us-east-1.amazonaws.com,
+	// objects are addressed path-style as Endpoint/Bucket/key.
+	Endpoint string
+	Bucket   string
+	Region   string
+
+	AccessKey string
+	SecretKey string
+
+	// Prefix is prepended to object keys.
+	Prefix string
+
+	// ACL is the canned ACL of objects, e.g. "public-read", omitted if empty.
+	ACL string
+
+	// PublicURL is the base URL objects are served from, defaults to Endpoint/Bucket.
+	PublicURL string
+}
+
+// Upload uploads an image to the bucket.
+func (su *S3Uploader) Upload(ctx context.Context, r io.Reader, mime string) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	payload := hex.EncodeToString(sum[:])
+	key := su.Prefix + payload + extension(mime)
+
+	endpoint, err := url.Parse(strings.TrimRight(su.Endpoint, "/"))
+	if err != nil {
+		return "", errors.Wrap(err, `parse endpoint failed`)
+	}
+	endpoint.Path += "/" + su.Bucket + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint.String(), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mime)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if su.ACL != "" {
+		req.Header.Set("X-Amz-Acl", su.ACL)
+	}
+	su.sign(req, payload, time.Now().UTC())
+
+	resp, err := httpClient(su.Client).Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, `upload image to S3 failed`)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", errors.Wrapf(newStatusError(resp), "upload image to S3 failed: %s", bytes.TrimSpace(msg))
+	}
+
+	if su.PublicURL != "" {
+		return strings.TrimRight(su.PublicURL, "/") + "/" + key, nil
+	}
+	return endpoint.String(), nil
+}
+
+// sign signs the request with AWS Signature Version 4.
+func (su *S3Uploader) sign(req *http.Request, payload string, now time.Time) {
+	region := su.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(req.Header.Get(key))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonical.String(),
+		signed,
+		payload,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := mac([]byte("AWS4"+su.SecretKey), date)
+	key = mac(key, region)
+	key = mac(key, "s3")
+	key = mac(key, "aws4_request")
+	signature := hex.EncodeToString(mac(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		su.AccessKey, scope, signed, signature))
+}
+
+// multipartBody encodes the image and extra fields as multipart form data.
+func multipartBody(field, mime string, r io.Reader, fields map[string]string) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for key, val := range fields {
+		if err := w.WriteField(key, val); err != nil {
+			return nil, "", err
+		}
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, "image"+extension(mime)))
+	header.Set("Content-Type", mime)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body, w.FormDataContentType(), nil
+}
+
+// doUpload posts the body to endpoint and returns the response body, non-2xx responses are errors.
+func doUpload(ctx context.Context, client *http.Client, endpoint, ctype string, body io.Reader, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, vals := range header {
+		req.Header[key] = vals
+	}
+	req.Header.Set("Content-Type", ctype)
+
+	resp, err := httpClient(client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return data, newStatusError(resp)
+	}
+
+	return data, nil
+}
+
+// resolveURL resolves ref against the URL base, ref is returned as is if base is invalid.
+func resolveURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+// extension returns the file extension of the mime type with leading dot.
+func extension(mtype string) string {
+	switch mtype {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	}
+	if exts, _ := mime.ExtensionsByType(mtype); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: timeout}
+	}
+	return client
+}
@@ -0,0 +1,175 @@
+// Copyright 2021 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package ph // import "github.com/wabarc/telegra.ph"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wabarc/telegra.ph/phtest"
+)
+
+// nolint:errcheck
+func TestTelegraphUploader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := r.FormFile("file"); err != nil {
+			io.WriteString(w, `{"error":"File type invalid"}`)
+			return
+		}
+		io.WriteString(w, `[{"src":"/file/image.png"}]`)
+	}))
+	defer ts.Close()
+
+	uploader := &TelegraphUploader{Client: ts.Client(), Endpoint: ts.URL + "/upload"}
+	dst, err := uploader.Upload(context.Background(), strings.NewReader("image"), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != ts.URL+"/file/image.png" {
+		t.Errorf("Unexpected image url, got %s instead of %s", dst, ts.URL+"/file/image.png")
+	}
+}
+
+// nolint:errcheck
+func TestMultipartUploader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.FormValue("album") != "wabarc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if _, _, err := r.FormFile("image"); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"data":{"url":"https://img.example.org/image.png"}}`)
+	}))
+	defer ts.Close()
+
+	uploader := &MultipartUploader{
+		Client:   ts.Client(),
+		Endpoint: ts.URL,
+		Field:    "image",
+		Fields:   map[string]string{"album": "wabarc"},
+		Header:   http.Header{"Authorization": {"Bearer token"}},
+		URLField: "data.url",
+	}
+	dst, err := uploader.Upload(context.Background(), strings.NewReader("image"), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != "https://img.example.org/image.png" {
+		t.Errorf("Unexpected image url, got %s", dst)
+	}
+}
+
+func TestS3Uploader(t *testing.T) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.Method != http.MethodPut || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		path = r.URL.Path
+	}))
+	defer ts.Close()
+
+	uploader := &S3Uploader{
+		Client:    ts.Client(),
+		Endpoint:  ts.URL,
+		Bucket:    "images",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PublicURL: "https://cdn.example.org",
+	}
+	dst, err := uploader.Upload(context.Background(), strings.NewReader("image"), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(path, "/images/") || !strings.HasSuffix(path, ".png") {
+		t.Errorf("Unexpected object path, got %s", path)
+	}
+	if dst != "https://cdn.example.org"+strings.TrimPrefix(path, "/images") {
+		t.Errorf("Unexpected image url, got %s", dst)
+	}
+}
+
+type uploaderFunc func(ctx context.Context, r io.Reader, mime string) (string, error)
+
+func (f uploaderFunc) Upload(ctx context.Context, r io.Reader, mime string) (string, error) {
+	return f(ctx, r, mime)
+}
+
+func TestUploadImageFallback(t *testing.T) {
+	f := genImage()
+	defer os.Remove(f.Name())
+
+	var mimes []string
+	failed := uploaderFunc(func(_ context.Context, r io.Reader, mime string) (string, error) {
+		mimes = append(mimes, mime)
+		return "", errors.New("rejected")
+	})
+	succeed := uploaderFunc(func(_ context.Context, r io.Reader, mime string) (string, error) {
+		mimes = append(mimes, mime)
+		return "https://example.org/image.png", nil
+	})
+
+	arc := New(WithImageUploaders(failed, succeed))
+	dst, err := arc.uploadImage(context.Background(), f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != "https://example.org/image.png" {
+		t.Errorf("Unexpected image url, got %s", dst)
+	}
+	if len(mimes) != 2 || mimes[1] != "image/png" {
+		t.Errorf("Unexpected uploads, got %v", mimes)
+	}
+}
+
+type countingTransport struct {
+	calls int32
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&ct.calls, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTelegraphEndpoints(t *testing.T) {
+	srv := phtest.NewServer()
+	defer srv.Close()
+
+	f := genImage()
+	defer os.Remove(f.Name())
+
+	transport := &countingTransport{}
+	arc := New(
+		WithBaseURL(srv.URL),
+		WithUploadURL(srv.UploadURL()),
+		WithTelegraphClient(&http.Client{Transport: transport}),
+	)
+	dsts, err := arc.Publish(context.Background(), Document{Title: "Testing", Screenshots: []string{f.Name()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dsts) != 1 || len(srv.Pages()) != 1 {
+		t.Fatalf("Unexpected pages, got %v", dsts)
+	}
+	if srv.Files() != 2 {
+		t.Errorf("Unexpected uploads, got %d instead of 2", srv.Files())
+	}
+	// createAccount, 2 uploads, createPage and editPage
+	if transport.calls != 5 {
+		t.Errorf("Unexpected calls of Telegraph client, got %d instead of 5", transport.calls)
+	}
+}